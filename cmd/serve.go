@@ -2,14 +2,22 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
 	"slices"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v3"
 	"golang.org/x/sync/errgroup"
@@ -36,10 +44,42 @@ var (
 
 	// ErrMqttInitError is returned if there was an error initializing the mqtt client.
 	ErrMqttInitError = errors.New("mqtt initialization error")
+
+	// ErrUnknownMessageStore is returned if the given message-store is not valid.
+	ErrUnknownMessageStore = errors.New("unknown message store")
+
+	// ErrDataDirRequired is returned if the file message-store is used without a data-dir.
+	ErrDataDirRequired = errors.New("data-dir is required")
+
+	// ErrTLSIncomplete is returned if the TLS flags are not set together.
+	ErrTLSIncomplete = errors.New("tls-cert and tls-key must be set together")
+
+	// ErrSignalAPITLSIncomplete is returned if the client certificate flags of
+	// the Signal API are not set together.
+	ErrSignalAPITLSIncomplete = errors.New("signal-api-client-cert and signal-api-client-key must be set together")
+
+	// ErrMqttAccountTopicsRequired is returned if several accounts are
+	// published to MQTT without mqtt-account-topics, their topics would collide.
+	ErrMqttAccountTopicsRequired = errors.New("mqtt-account-topics is required to publish several accounts")
+
+	// ErrKeepaliveWebsocketOnly is returned if a keepalive flag is set in a
+	// signal-api-mode other than websocket.
+	ErrKeepaliveWebsocketOnly = errors.New("the keepalive flags only apply to the websocket signal-api-mode")
+
+	// ErrInvalidHeader is returned if a signal-api-header or a
+	// signal-api-header-file is not valid.
+	ErrInvalidHeader = errors.New("invalid header")
+
+	// ErrMqttDisconnected is reported by the mqtt readiness check if the
+	// connection to the broker is down.
+	ErrMqttDisconnected = errors.New("the connection to the mqtt broker is down")
 )
 
 const (
 	MqttCat = "MQTT"
+
+	messageStoreMemory = "memory"
+	messageStoreFile   = "file"
 )
 
 func serveCommand() *cli.Command {
@@ -74,17 +114,28 @@ func serveCommand() *cli.Command {
 				Usage:   "Repeat the last message if there are no new messages (applies to /receive/pop)",
 				Sources: cli.EnvVars("REPEAT_LAST_MESSAGE"),
 			},
-			&cli.StringFlag{
-				Name:     "signal-account",
-				Usage:    "The account number for signal",
+			&cli.StringSliceFlag{
+				Name: "signal-account",
+				Usage: "The account number for signal. Can be repeated to receive the messages of several " +
+					"accounts, the first one is served by the routes that are not scoped to an account",
 				Sources:  cli.EnvVars("SIGNAL_ACCOUNT"),
 				Required: true,
-				Validator: func(a string) error {
-					if !accountRegex.MatchString(a) {
-						return fmt.Errorf(
-							"%w: phone number must have leading + followed only by numbers",
-							ErrInvalidSignalAccount,
-						)
+				Validator: func(accounts []string) error {
+					seen := make(map[string]bool, len(accounts))
+
+					for _, a := range accounts {
+						if !accountRegex.MatchString(a) {
+							return fmt.Errorf(
+								"%w: phone number must have leading + followed only by numbers",
+								ErrInvalidSignalAccount,
+							)
+						}
+
+						if seen[a] {
+							return fmt.Errorf("%w: %q is given more than once", ErrInvalidSignalAccount, a)
+						}
+
+						seen[a] = true
 					}
 
 					return nil
@@ -108,12 +159,237 @@ func serveCommand() *cli.Command {
 					return nil
 				},
 			},
+			&cli.StringFlag{
+				Name:    "signal-api-ca",
+				Usage:   "Trust this PEM encoded CA, along with the system ones, to verify the Signal API certificate",
+				Sources: cli.EnvVars("SIGNAL_API_CA"),
+			},
+			&cli.StringFlag{
+				Name:    "signal-api-client-cert",
+				Usage:   "Present this PEM encoded client certificate to the Signal API, reloaded on every connect",
+				Sources: cli.EnvVars("SIGNAL_API_CLIENT_CERT"),
+			},
+			&cli.StringFlag{
+				Name:    "signal-api-client-key",
+				Usage:   "The PEM encoded key of the signal-api-client-cert, reloaded on every connect",
+				Sources: cli.EnvVars("SIGNAL_API_CLIENT_KEY"),
+			},
+			&cli.BoolFlag{
+				Name:    "signal-api-insecure-skip-verify",
+				Usage:   "Do not verify the Signal API certificate",
+				Sources: cli.EnvVars("SIGNAL_API_INSECURE_SKIP_VERIFY"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "signal-api-header",
+				Usage:   "A header sent to the Signal API, as <name>: <value>. Can be repeated",
+				Sources: cli.EnvVars("SIGNAL_API_HEADERS"),
+				Validator: func(headers []string) error {
+					_, err := parseHeaders(headers)
+
+					return err
+				},
+			},
+			&cli.StringSliceFlag{
+				Name: "signal-api-header-file",
+				Usage: "A header sent to the Signal API, as <name>=<path> of the file holding its value, read on " +
+					"every connect, e.g. Authorization=/run/secrets/signal-api-token. Can be repeated",
+				Sources: cli.EnvVars("SIGNAL_API_HEADER_FILES"),
+				Validator: func(headerFiles []string) error {
+					_, err := parseHeaderFiles(headerFiles)
+
+					return err
+				},
+			},
+			&cli.StringFlag{
+				Name: "message-store",
+				Usage: fmt.Sprintf(
+					"Where to keep the recorded messages, one of %v (default: %s if data-dir is set, %s otherwise)",
+					[]string{messageStoreMemory, messageStoreFile},
+					messageStoreFile,
+					messageStoreMemory,
+				),
+				Sources: cli.EnvVars("MESSAGE_STORE"),
+				Validator: func(s string) error {
+					if s != messageStoreMemory && s != messageStoreFile {
+						return fmt.Errorf("%w: %q", ErrUnknownMessageStore, s)
+					}
+
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name: "data-dir",
+				Usage: "The directory used by the file message-store to persist the recorded messages, " +
+					"in a sub-directory per account",
+				Sources: cli.EnvVars("DATA_DIR"),
+			},
+			&cli.StringSliceFlag{
+				Name: "consumer",
+				Usage: "Declare a consumer that keeps its own cursor over the recorded messages " +
+					"(/receive/{consumer}/pop and /receive/{consumer}/flush). " +
+					"Only the declared consumers exist, consumers that are no longer declared are removed on startup",
+				Sources: cli.EnvVars("CONSUMERS"),
+				Value:   []string{receiver.DefaultConsumer},
+				Validator: func(names []string) error {
+					for _, name := range names {
+						if err := receiver.ValidateConsumer(name); err != nil {
+							return fmt.Errorf("%w: %q", err, name)
+						}
+					}
+
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:    "queue-max-messages",
+				Usage:   "The maximum number of messages kept in the queue (0 means unlimited)",
+				Sources: cli.EnvVars("QUEUE_MAX_MESSAGES"),
+			},
+			&cli.DurationFlag{
+				Name:    "queue-max-age",
+				Usage:   "The maximum age of a message that was not consumed by every consumer yet (0 means unlimited)",
+				Sources: cli.EnvVars("QUEUE_MAX_AGE"),
+			},
+			&cli.DurationFlag{
+				Name: "history-retention",
+				Usage: "How long messages are kept for /receive/since after every consumer consumed them, " +
+					"regardless of the queue maximum age (0 means they are removed right away)",
+				Sources: cli.EnvVars("HISTORY_RETENTION"),
+			},
+			&cli.StringFlag{
+				Name: "queue-overflow-policy",
+				Usage: fmt.Sprintf(
+					"What to do with new messages when the queue is full. Valid policies: %v",
+					receiver.AllOverflowPolicies(),
+				),
+				Sources: cli.EnvVars("QUEUE_OVERFLOW_POLICY"),
+				Value:   receiver.OverflowPolicyDropOldest.String(),
+				Validator: func(op string) error {
+					if _, err := receiver.ParseOverflowPolicy(op); err != nil {
+						return fmt.Errorf("could not parse overflow policy %q: %w", op, err)
+					}
+
+					return nil
+				},
+			},
+			&cli.DurationFlag{
+				Name:    "dedup-window",
+				Usage:   "How long an envelope is remembered to drop its duplicates (0 disables deduplication)",
+				Sources: cli.EnvVars("DEDUP_WINDOW"),
+				Value:   receiver.DefaultDedupWindow,
+			},
+			&cli.DurationFlag{
+				Name:    "reconnect-initial-delay",
+				Usage:   "The delay before the first attempt to reconnect to the Signal API, doubled after every failure",
+				Sources: cli.EnvVars("RECONNECT_INITIAL_DELAY"),
+				Value:   receiver.DefaultReconnectInitialDelay,
+			},
+			&cli.DurationFlag{
+				Name:    "reconnect-max-delay",
+				Usage:   "The maximum delay between two attempts to reconnect to the Signal API",
+				Sources: cli.EnvVars("RECONNECT_MAX_DELAY"),
+				Value:   receiver.DefaultReconnectMaxDelay,
+			},
+			&cli.IntFlag{
+				Name: "reconnect-max-attempts",
+				Usage: "Exit after this many attempts to reconnect to the Signal API failed in a row " +
+					"(0 means never give up)",
+				Sources: cli.EnvVars("RECONNECT_MAX_ATTEMPTS"),
+			},
+			&cli.DurationFlag{
+				Name: "keepalive-ping-interval",
+				Usage: "How often a ping is sent to the Signal API to detect a dead websocket (0 disables the pings), " +
+					"websocket mode only",
+				Sources: cli.EnvVars("KEEPALIVE_PING_INTERVAL"),
+				Value:   receiver.DefaultPingInterval,
+			},
+			&cli.DurationFlag{
+				Name:    "keepalive-pong-timeout",
+				Usage:   "How long the Signal API has to answer a ping before the websocket is reconnected, websocket mode only",
+				Sources: cli.EnvVars("KEEPALIVE_PONG_TIMEOUT"),
+				Value:   receiver.DefaultPongTimeout,
+			},
+			&cli.DurationFlag{
+				Name: "keepalive-max-silence",
+				Usage: "Reconnect the websocket if no message was received from the Signal API for this long " +
+					"(0 disables it), websocket mode only",
+				Sources: cli.EnvVars("KEEPALIVE_MAX_SILENCE"),
+			},
+			&cli.StringFlag{
+				Name: "signal-api-mode",
+				Usage: fmt.Sprintf(
+					"How the messages are received, %s from signal-cli-rest-api in json-rpc mode, %s from it "+
+						"in normal or native mode or %s from signal-cli daemon at a tcp:// or unix:// "+
+						"signal-api-url. Valid modes: %v",
+					receiver.ModeWebsocket, receiver.ModePoll, receiver.ModeDaemon, receiver.AllModes(),
+				),
+				Sources: cli.EnvVars("SIGNAL_API_MODE"),
+				Value:   receiver.ModeWebsocket.String(),
+				Validator: func(m string) error {
+					if _, err := receiver.ParseMode(m); err != nil {
+						return fmt.Errorf("could not parse mode %q: %w", m, err)
+					}
+
+					return nil
+				},
+			},
+			&cli.DurationFlag{
+				Name:    "poll-interval",
+				Usage:   "The delay between the end of a poll of the Signal API and the next one in poll mode",
+				Sources: cli.EnvVars("POLL_INTERVAL"),
+				Value:   receiver.DefaultPollInterval,
+			},
+			&cli.DurationFlag{
+				Name:    "poll-timeout",
+				Usage:   "How long signal-cli waits for messages during a poll in poll mode, rounded down to the second",
+				Sources: cli.EnvVars("POLL_TIMEOUT"),
+				Value:   receiver.DefaultPollTimeout,
+			},
 			&cli.StringFlag{
 				Name:    "server-addr",
 				Usage:   "The address of the server",
 				Sources: cli.EnvVars("SERVER_ADDR"),
 				Value:   ":8105",
 			},
+			&cli.DurationFlag{
+				Name: "shutdown-timeout",
+				Usage: "How long a graceful shutdown waits for the in-flight requests, the notifier handlers and " +
+					"the queued MQTT publishes",
+				Sources: cli.EnvVars("SHUTDOWN_TIMEOUT"),
+				Value:   30 * time.Second,
+			},
+			&cli.StringSliceFlag{
+				Name: "api-key",
+				Usage: "An API key required to use the HTTP server, as <key>[:<scope>] where the scope is read or " +
+					"consume (the default). Can be repeated",
+				Sources: cli.EnvVars("API_KEYS"),
+			},
+			&cli.StringFlag{
+				Name:    "tls-cert",
+				Usage:   "Serve HTTPS with this PEM encoded certificate, reloaded when the file changes",
+				Sources: cli.EnvVars("TLS_CERT"),
+			},
+			&cli.StringFlag{
+				Name:    "tls-key",
+				Usage:   "The PEM encoded key of the tls-cert, reloaded when the file changes",
+				Sources: cli.EnvVars("TLS_KEY"),
+			},
+			&cli.StringFlag{
+				Name:    "tls-client-ca",
+				Usage:   "Require client certificates signed by this PEM encoded CA, reloaded when the file changes",
+				Sources: cli.EnvVars("TLS_CLIENT_CA"),
+			},
+			&cli.DurationFlag{
+				Name: "ready-max-frame-age",
+				Usage: "Report the server as not ready on /readyz if no frame was received from the Signal API " +
+					"for this long (0 only reports the time since the last frame)",
+				Sources: cli.EnvVars("READY_MAX_FRAME_AGE"),
+			},
+			&cli.StringFlag{
+				Name:    "api-keys-file",
+				Usage:   "A file with the API keys required to use the HTTP server, one <key>[:<scope>] per line",
+				Sources: cli.EnvVars("API_KEYS_FILE"),
+			},
 			&cli.StringFlag{
 				Name:     "mqtt-server",
 				Category: MqttCat,
@@ -145,6 +421,15 @@ func serveCommand() *cli.Command {
 				Sources:  cli.EnvVars("MQTT_TOPIC_PREFIX"),
 				Value:    "signal-api-receiver",
 			},
+			&cli.BoolFlag{
+				Name:        "mqtt-account-topics",
+				Category:    MqttCat,
+				DefaultText: "false",
+				Usage: "Include the account in the topics, e.g. {topic-prefix}/15551234567/" +
+					mqttconfig.TopicMessageSuffix + ", required with several signal-account",
+				Sources: cli.EnvVars("MQTT_ACCOUNT_TOPICS"),
+				Value:   false,
+			},
 			&cli.Uint8Flag{
 				Name:     "mqtt-qos",
 				Category: MqttCat,
@@ -180,6 +465,14 @@ func serveCommand() *cli.Command {
 				Sources:     cli.EnvVars("MQTT_INSECURE_SKIP_VERIFY"),
 				Value:       false,
 			},
+			&cli.BoolFlag{
+				Name:        "mqtt-required-for-readiness",
+				Category:    MqttCat,
+				DefaultText: "false",
+				Usage:       "Report the server as not ready on /readyz while the connection to the broker is down",
+				Sources:     cli.EnvVars("MQTT_REQUIRED_FOR_READINESS"),
+				Value:       false,
+			},
 		},
 		Before: mqtt.ValidateFlags,
 	}
@@ -191,6 +484,10 @@ func serveAction() cli.ActionFunc {
 
 		ctx = logger.WithContext(ctx)
 
+		// SIGINT and SIGTERM start a graceful shutdown.
+		stopCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
 		ctx, cancel := context.WithCancel(ctx)
 
 		g, ctx := errgroup.WithContext(ctx)
@@ -212,43 +509,80 @@ func serveAction() cli.ActionFunc {
 
 		signalAPIURL := cmd.String("signal-api-url")
 
-		uri, err := url.Parse(signalAPIURL)
+		apiURL, err := url.Parse(signalAPIURL)
 		if err != nil {
 			return fmt.Errorf("error parsing the url %q: %w", signalAPIURL, err)
 		}
 
-		uri = uri.JoinPath(fmt.Sprintf("/v1/receive/%s", cmd.String("signal-account")))
-
-		logger.Info().
-			Str("signal-api-url", uri.String()).
-			Msg("the fully qualified signal-api URL was computed")
-
-		sarc, err := receiver.New(ctx, uri, cmd.StringSlice("record-message-type")...)
+		dialOpts, err := newDialOptions(cmd)
 		if err != nil {
-			return fmt.Errorf("error creating a new receiver: %w", err)
+			return err
 		}
 
-		// NOTE: defer runs last to first; shutdown handlers before canceling
-		// context so in-flight work can finish, then cancel to stop goroutines.
-		defer func() {
-			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer shutdownCancel()
+		accounts := cmd.StringSlice("signal-account")
+		clients := make([]*receiver.Client, 0, len(accounts))
+		serverOpts := []server.Option{server.WithMaxFrameAge(cmd.Duration("ready-max-frame-age"))}
+
+		for i, account := range accounts {
+			// every account keeps its messages in a sub-directory of the
+			// data-dir named after it, so adding an account does not move them.
+			dataDir := cmd.String("data-dir")
+			if dataDir != "" {
+				accountDir := filepath.Join(dataDir, account)
+
+				// the data-dir used to hold the messages of the first account.
+				if i == 0 {
+					moved, err := receiver.MoveFileStore(dataDir, accountDir)
+					if err != nil {
+						return fmt.Errorf("error moving the message store of %s: %w", account, err)
+					}
+
+					if moved {
+						logger.Info().
+							Str("account", account).
+							Str("data-dir", accountDir).
+							Msg("the message store was moved to the directory of the account")
+					}
+				}
 
-			if err := sarc.MessageNotifier.Shutdown(shutdownCtx); err != nil {
-				logger.Error().Err(err).Msg("error while shutting down notifier")
+				dataDir = accountDir
+			}
+
+			store, err := newMessageStore(cmd, dataDir)
+			if err != nil {
+				return fmt.Errorf("error opening the message store of %s: %w", account, err)
 			}
-		}()
+
+			defer store.Close()
+
+			sarc, err := newReceiver(ctx, cmd, apiURL, account, store, dialOpts)
+			if err != nil {
+				return fmt.Errorf("error creating a new receiver for %s: %w", account, err)
+			}
+
+			clients = append(clients, sarc)
+			serverOpts = append(serverOpts, server.WithAccount(account, sarc))
+		}
+
+		if err := receiver.RegisterMetrics(prometheus.DefaultRegisterer, clients...); err != nil {
+			return err
+		}
+
+		var mqttConn *mqtt.Connection
 
 		if cmd.IsSet("mqtt-server") {
+			if len(clients) > 1 && !cmd.Bool("mqtt-account-topics") {
+				return ErrMqttAccountTopicsRequired
+			}
+
 			clientID := cmd.String("mqtt-client-id")
 
 			if clientID == "" {
-				clientID = mqtt.MakeClientID(sarc.LocalAddr())
+				clientID = mqtt.MakeClientID(clients[0].LocalAddr())
 			}
 
-			err := mqtt.Init(
+			mqttConn, err = mqtt.Init(
 				ctx,
-				sarc.MessageNotifier,
 				mqttconfig.InitOptions{
 					Server:             cmd.String("mqtt-server"),
 					ClientID:           clientID,
@@ -263,24 +597,358 @@ func serveAction() cli.ActionFunc {
 			if err != nil {
 				return fmt.Errorf("%w: %w", ErrMqttInitError, err)
 			}
+
+			for _, sarc := range clients {
+				topicAccount := ""
+				if cmd.Bool("mqtt-account-topics") {
+					topicAccount = sarc.Account()
+				}
+
+				mqttConn.Broadcast(ctx, sarc.MessageNotifier, topicAccount)
+			}
+
+			serverOpts = append(serverOpts, server.WithCheck(server.Check{
+				Name:     "mqtt",
+				Required: cmd.Bool("mqtt-required-for-readiness"),
+				Run: func() (map[string]any, error) {
+					connected := mqttConn.Connected()
+					details := map[string]any{"connected": connected}
+
+					if !connected {
+						return details, ErrMqttDisconnected
+					}
+
+					return details, nil
+				},
+			}))
+		}
+
+		apiKeys, err := loadAPIKeys(cmd)
+		if err != nil {
+			return fmt.Errorf("error loading the API keys: %w", err)
 		}
 
-		srv := server.New(ctx, sarc, cmd.Bool("repeat-last-message"))
+		if len(apiKeys) == 0 {
+			logger.Warn().Msg("no API key is set, anyone who can reach the server can consume the messages")
+		}
+
+		serverOpts = append(serverOpts, server.WithAPIKeys(apiKeys))
+
+		srv := server.New(ctx, clients[0], cmd.Bool("repeat-last-message"), serverOpts...)
+
+		// stream the recorded messages to the subscribers of /receive/events.
+		for _, sarc := range clients {
+			sarc.MessageNotifier.RegisterHandler(ctx, srv.Account(sarc.Account()))
+		}
+
+		tlsConfig, err := newTLSConfig(cmd, logger)
+		if err != nil {
+			return fmt.Errorf("error loading the TLS certificates: %w", err)
+		}
 
 		server := &http.Server{
 			Addr:              cmd.String("server-addr"),
 			Handler:           srv,
 			ReadHeaderTimeout: 10 * time.Second,
+			TLSConfig:         tlsConfig,
 		}
 
+		// end the long-polls and the streams, they would hold the drain up.
+		server.RegisterOnShutdown(srv.Drain)
+
 		logger.Info().
 			Str("server-addr", cmd.String("server-addr")).
+			Bool("tls", tlsConfig != nil).
 			Msg("Server started")
 
-		if err := server.ListenAndServe(); err != nil {
+		runErr := make(chan error, len(clients))
+
+		for _, sarc := range clients {
+			go func() {
+				if err := sarc.Run(ctx); err != nil {
+					runErr <- fmt.Errorf("%s: %w", sarc.Account(), err)
+				}
+			}()
+		}
+
+		listenErr := make(chan error, 1)
+
+		go func() {
+			if tlsConfig != nil {
+				// the certificates are served by the TLS config.
+				listenErr <- server.ListenAndServeTLS("", "")
+			} else {
+				listenErr <- server.ListenAndServe()
+			}
+		}()
+
+		select {
+		case err := <-listenErr:
+			shutdown(ctx, cmd.Duration("shutdown-timeout"), server, clients, mqttConn)
+
 			return fmt.Errorf("error starting the HTTP listener: %w", err)
+		case err := <-runErr:
+			shutdown(ctx, cmd.Duration("shutdown-timeout"), server, clients, mqttConn)
+
+			return fmt.Errorf("error receiving from the Signal API: %w", err)
+		case <-stopCtx.Done():
+			// a second signal kills the process right away.
+			stop()
 		}
 
+		shutdown(ctx, cmd.Duration("shutdown-timeout"), server, clients, mqttConn)
+
 		return nil
 	}
 }
+
+// shutdown stops accepting connections and waits for the in-flight requests,
+// closes the websockets to the Signal API, waits for the notifier handlers and
+// sends the queued MQTT publishes. The steps run in this order so a message is
+// not lost on the way out, and they share the timeout.
+func shutdown(
+	ctx context.Context,
+	timeout time.Duration,
+	httpServer *http.Server,
+	clients []*receiver.Client,
+	mqttConn *mqtt.Connection,
+) {
+	logger := zerolog.Ctx(ctx)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	logger.Info().Dur("timeout", timeout).Msg("shutting down")
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Msg("error draining the HTTP server, closing the remaining connections")
+
+		if err := httpServer.Close(); err != nil {
+			logger.Error().Err(err).Msg("error closing the HTTP server")
+		}
+	}
+
+	for _, sarc := range clients {
+		if err := sarc.Close(ctx); err != nil {
+			logger.Error().Err(err).Str("account", sarc.Account()).Msg("error closing the websocket to the Signal API")
+		}
+	}
+
+	for _, sarc := range clients {
+		if err := sarc.MessageNotifier.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Str("account", sarc.Account()).Msg("error while shutting down notifier")
+		}
+	}
+
+	if mqttConn != nil {
+		if err := mqttConn.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("error while shutting down the mqtt connection")
+		}
+	}
+
+	logger.Info().Msg("shutdown complete")
+}
+
+// newReceiver returns a client receiving the messages of the account from the
+// Signal API into the store.
+func newReceiver(
+	ctx context.Context,
+	cmd *cli.Command,
+	apiURL *url.URL,
+	account string,
+	store receiver.MessageStore,
+	dialOpts receiver.DialOptions,
+) (*receiver.Client, error) {
+	overflowPolicy, err := receiver.ParseOverflowPolicy(cmd.String("queue-overflow-policy"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the queue-overflow-policy: %w", err)
+	}
+
+	mode, err := receiver.ParseMode(cmd.String("signal-api-mode"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the signal-api-mode: %w", err)
+	}
+
+	if mode != receiver.ModeWebsocket {
+		for _, name := range []string{"keepalive-ping-interval", "keepalive-pong-timeout", "keepalive-max-silence"} {
+			if cmd.IsSet(name) {
+				return nil, fmt.Errorf("%w: %s is set in the %s mode", ErrKeepaliveWebsocketOnly, name, mode)
+			}
+		}
+	}
+
+	// signal-cli daemon serves every account at the same address.
+	uri := apiURL
+	if mode != receiver.ModeDaemon {
+		uri = apiURL.JoinPath(fmt.Sprintf("/v1/receive/%s", account))
+	}
+
+	zerolog.Ctx(ctx).Info().
+		Str("signal-api-url", uri.String()).
+		Msg("the fully qualified signal-api URL was computed")
+
+	return receiver.New(ctx, uri, receiver.Options{
+		Account:      account,
+		MessageTypes: cmd.StringSlice("record-message-type"),
+		Store:        store,
+		Consumers:    cmd.StringSlice("consumer"),
+		QueueLimits: receiver.QueueLimits{
+			MaxMessages:    cmd.Int("queue-max-messages"),
+			MaxAge:         cmd.Duration("queue-max-age"),
+			OverflowPolicy: overflowPolicy,
+		},
+		DedupWindow: cmd.Duration("dedup-window"),
+		Reconnect: receiver.ReconnectPolicy{
+			InitialDelay: cmd.Duration("reconnect-initial-delay"),
+			MaxDelay:     cmd.Duration("reconnect-max-delay"),
+			MaxAttempts:  cmd.Int("reconnect-max-attempts"),
+		},
+		Keepalive: receiver.KeepalivePolicy{
+			PingInterval: cmd.Duration("keepalive-ping-interval"),
+			PongTimeout:  cmd.Duration("keepalive-pong-timeout"),
+			MaxSilence:   cmd.Duration("keepalive-max-silence"),
+		},
+		Dial: dialOpts,
+		Mode: mode,
+		Poll: receiver.PollPolicy{
+			Interval: cmd.Duration("poll-interval"),
+			Timeout:  cmd.Duration("poll-timeout"),
+		},
+	})
+}
+
+// newDialOptions returns how the websocket to the Signal API is opened, as set
+// with the signal-api flags.
+func newDialOptions(cmd *cli.Command) (receiver.DialOptions, error) {
+	opts := receiver.DialOptions{
+		CAFile:             cmd.String("signal-api-ca"),
+		CertFile:           cmd.String("signal-api-client-cert"),
+		KeyFile:            cmd.String("signal-api-client-key"),
+		InsecureSkipVerify: cmd.Bool("signal-api-insecure-skip-verify"),
+	}
+
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return receiver.DialOptions{}, ErrSignalAPITLSIncomplete
+	}
+
+	var err error
+
+	if opts.Header, err = parseHeaders(cmd.StringSlice("signal-api-header")); err != nil {
+		return receiver.DialOptions{}, err
+	}
+
+	if opts.HeaderFiles, err = parseHeaderFiles(cmd.StringSlice("signal-api-header-file")); err != nil {
+		return receiver.DialOptions{}, err
+	}
+
+	return opts, nil
+}
+
+// parseHeaders parses headers given as <name>: <value>.
+func parseHeaders(headers []string) (http.Header, error) {
+	header := make(http.Header, len(headers))
+
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%w: %q is not <name>: <value>", ErrInvalidHeader, h)
+		}
+
+		header.Add(name, strings.TrimSpace(value))
+	}
+
+	return header, nil
+}
+
+// parseHeaderFiles parses headers given as <name>=<path> of the file holding
+// their value.
+func parseHeaderFiles(headerFiles []string) (map[string]string, error) {
+	files := make(map[string]string, len(headerFiles))
+
+	for _, hf := range headerFiles {
+		name, path, ok := strings.Cut(hf, "=")
+
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("%w: %q is not <name>=<path>", ErrInvalidHeader, hf)
+		}
+
+		files[name] = path
+	}
+
+	return files, nil
+}
+
+// newMessageStore opens the message store selected by the flags, the file store
+// keeps its journal in dataDir.
+func newMessageStore(cmd *cli.Command, dataDir string) (receiver.MessageStore, error) {
+	storeType := cmd.String("message-store")
+	if storeType == "" {
+		storeType = messageStoreMemory
+
+		if cmd.String("data-dir") != "" {
+			storeType = messageStoreFile
+		}
+	}
+
+	opts := receiver.StoreOptions{HistoryRetention: cmd.Duration("history-retention")}
+
+	switch storeType {
+	case messageStoreMemory:
+		// the IDs are seeded from the clock so they keep increasing across
+		// restarts, the cursors of the clients stay valid.
+		opts.FirstID = uint64(time.Now().UnixMicro()) //nolint:gosec // the clock is past the epoch.
+
+		return receiver.NewMemoryStore(opts), nil
+	case messageStoreFile:
+		if dataDir == "" {
+			return nil, fmt.Errorf("%w: the %s message-store needs a data-dir", ErrDataDirRequired, messageStoreFile)
+		}
+
+		return receiver.NewFileStore(dataDir, opts)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMessageStore, storeType)
+	}
+}
+
+// loadAPIKeys returns the API keys set with the api-key flag and in the
+// api-keys-file.
+func loadAPIKeys(cmd *cli.Command) (server.APIKeys, error) {
+	keys, err := server.ParseAPIKeys(cmd.StringSlice("api-key"))
+	if err != nil {
+		return nil, err
+	}
+
+	if path := cmd.String("api-keys-file"); path != "" {
+		fileKeys, err := server.LoadAPIKeys(path)
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(keys, fileKeys)
+	}
+
+	return keys, nil
+}
+
+// newTLSConfig returns the TLS config set with the TLS flags, or nil if the
+// server does not serve HTTPS.
+func newTLSConfig(cmd *cli.Command, logger zerolog.Logger) (*tls.Config, error) {
+	opts := server.TLSOptions{
+		CertFile:     cmd.String("tls-cert"),
+		KeyFile:      cmd.String("tls-key"),
+		ClientCAFile: cmd.String("tls-client-ca"),
+	}
+
+	if opts.CertFile == "" && opts.KeyFile == "" && opts.ClientCAFile == "" {
+		return nil, nil //nolint:nilnil // HTTPS is not enabled.
+	}
+
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, ErrTLSIncomplete
+	}
+
+	return server.NewTLSConfig(logger, opts)
+}
@@ -13,6 +13,9 @@ const (
 	TopicMessageSuffix   string = "message"
 	TopicOnlineSuffix    string = "online"
 	TopicConnectedSuffix string = "connected"
+	TopicEvictedSuffix   string = "evicted"
+	TopicDeletedSuffix   string = "deleted"
+	TopicEditedSuffix    string = "edited"
 
 	sessionExpiryInterval                 uint32 = 60
 	keepAlive                             uint16 = 20
@@ -47,6 +50,9 @@ type Topics struct {
 	Message   string
 	Status    string
 	Connected string
+	Evicted   string
+	Deleted   string
+	Edited    string
 }
 
 func New(options InitOptions) *Config {
@@ -123,16 +129,41 @@ func cleanStartOnInitialConnection(qos uint8) bool {
 	return cleanStartOnInitialConnectionFallback
 }
 
-func marshalTopics(topicPrefix string) *Topics {
+// AccountTopics returns the topics of the account's messages and state, they
+// are under the topic prefix followed by the account without its leading plus
+// sign, which MQTT reserves as a wildcard. The status topic is shared by the
+// accounts, and the topics are not scoped if the account is empty.
+func (c Config) AccountTopics(account string) *Topics {
+	account = strings.Trim(account, "+#/ ")
+	if account == "" {
+		return c.Topics
+	}
+
+	topics := marshalTopics(trimTopicPrefix(c.TopicPrefix) + "/" + account)
+	topics.Status = c.Topics.Status
+
+	return topics
+}
+
+func trimTopicPrefix(topicPrefix string) string {
 	topicPrefix = strings.Trim(topicPrefix, "#/ ")
 
 	if topicPrefix == "" {
 		topicPrefix = ClientPrefix
 	}
 
+	return topicPrefix
+}
+
+func marshalTopics(topicPrefix string) *Topics {
+	topicPrefix = trimTopicPrefix(topicPrefix)
+
 	return &Topics{
 		Message:   topicPrefix + "/" + TopicMessageSuffix,
 		Status:    topicPrefix + "/" + TopicOnlineSuffix,
 		Connected: topicPrefix + "/" + TopicConnectedSuffix,
+		Evicted:   topicPrefix + "/" + TopicEvictedSuffix,
+		Deleted:   topicPrefix + "/" + TopicDeletedSuffix,
+		Edited:    topicPrefix + "/" + TopicEditedSuffix,
 	}
 }
@@ -17,6 +17,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   "signal/" + TopicMessageSuffix,
 				Status:    "signal/" + TopicOnlineSuffix,
 				Connected: "signal/" + TopicConnectedSuffix,
+				Evicted:   "signal/" + TopicEvictedSuffix,
+				Deleted:   "signal/" + TopicDeletedSuffix,
+				Edited:    "signal/" + TopicEditedSuffix,
 			},
 		},
 		{
@@ -26,6 +29,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   "signal/api/" + TopicMessageSuffix,
 				Status:    "signal/api/" + TopicOnlineSuffix,
 				Connected: "signal/api/" + TopicConnectedSuffix,
+				Evicted:   "signal/api/" + TopicEvictedSuffix,
+				Deleted:   "signal/api/" + TopicDeletedSuffix,
+				Edited:    "signal/api/" + TopicEditedSuffix,
 			},
 		},
 		{
@@ -35,6 +41,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   "signal-api/" + TopicMessageSuffix,
 				Status:    "signal-api/" + TopicOnlineSuffix,
 				Connected: "signal-api/" + TopicConnectedSuffix,
+				Evicted:   "signal-api/" + TopicEvictedSuffix,
+				Deleted:   "signal-api/" + TopicDeletedSuffix,
+				Edited:    "signal-api/" + TopicEditedSuffix,
 			},
 		},
 		{
@@ -44,6 +53,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   "signal-api/" + TopicMessageSuffix,
 				Status:    "signal-api/" + TopicOnlineSuffix,
 				Connected: "signal-api/" + TopicConnectedSuffix,
+				Evicted:   "signal-api/" + TopicEvictedSuffix,
+				Deleted:   "signal-api/" + TopicDeletedSuffix,
+				Edited:    "signal-api/" + TopicEditedSuffix,
 			},
 		},
 		{
@@ -53,6 +65,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   "signal-api/" + TopicMessageSuffix,
 				Status:    "signal-api/" + TopicOnlineSuffix,
 				Connected: "signal-api/" + TopicConnectedSuffix,
+				Evicted:   "signal-api/" + TopicEvictedSuffix,
+				Deleted:   "signal-api/" + TopicDeletedSuffix,
+				Edited:    "signal-api/" + TopicEditedSuffix,
 			},
 		},
 		{
@@ -62,6 +77,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   ClientPrefix + "/message",
 				Status:    ClientPrefix + "/online",
 				Connected: ClientPrefix + "/connected",
+				Evicted:   ClientPrefix + "/evicted",
+				Deleted:   ClientPrefix + "/deleted",
+				Edited:    ClientPrefix + "/edited",
 			},
 		},
 		{
@@ -71,6 +89,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   ClientPrefix + "/message",
 				Status:    ClientPrefix + "/online",
 				Connected: ClientPrefix + "/connected",
+				Evicted:   ClientPrefix + "/evicted",
+				Deleted:   ClientPrefix + "/deleted",
+				Edited:    ClientPrefix + "/edited",
 			},
 		},
 		{
@@ -80,6 +101,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   ClientPrefix + "/message",
 				Status:    ClientPrefix + "/online",
 				Connected: ClientPrefix + "/connected",
+				Evicted:   ClientPrefix + "/evicted",
+				Deleted:   ClientPrefix + "/deleted",
+				Edited:    ClientPrefix + "/edited",
 			},
 		},
 		{
@@ -89,6 +113,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   ClientPrefix + "/message",
 				Status:    ClientPrefix + "/online",
 				Connected: ClientPrefix + "/connected",
+				Evicted:   ClientPrefix + "/evicted",
+				Deleted:   ClientPrefix + "/deleted",
+				Edited:    ClientPrefix + "/edited",
 			},
 		},
 		{
@@ -98,6 +125,9 @@ func TestMarshalTopics(t *testing.T) {
 				Message:   ClientPrefix + "/" + TopicMessageSuffix,
 				Status:    ClientPrefix + "/" + TopicOnlineSuffix,
 				Connected: ClientPrefix + "/" + TopicConnectedSuffix,
+				Evicted:   ClientPrefix + "/" + TopicEvictedSuffix,
+				Deleted:   ClientPrefix + "/" + TopicDeletedSuffix,
+				Edited:    ClientPrefix + "/" + TopicEditedSuffix,
 			},
 		},
 	}
@@ -118,3 +148,27 @@ func TestMarshalTopics(t *testing.T) {
 		})
 	}
 }
+
+func TestAccountTopics(t *testing.T) {
+	t.Parallel()
+
+	cfg := New(InitOptions{TopicPrefix: "signal/"})
+
+	got := cfg.AccountTopics("+15550000001")
+	want := Topics{
+		Message:   "signal/15550000001/" + TopicMessageSuffix,
+		Status:    "signal/" + TopicOnlineSuffix,
+		Connected: "signal/15550000001/" + TopicConnectedSuffix,
+		Evicted:   "signal/15550000001/" + TopicEvictedSuffix,
+		Deleted:   "signal/15550000001/" + TopicDeletedSuffix,
+		Edited:    "signal/15550000001/" + TopicEditedSuffix,
+	}
+
+	if *got != want {
+		t.Fatalf("unexpected topics: got %#v, want %#v", *got, want)
+	}
+
+	if got := cfg.AccountTopics(""); got != cfg.Topics {
+		t.Fatalf("expected the topics of no account to be unscoped, got %#v", *got)
+	}
+}
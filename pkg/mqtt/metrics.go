@@ -0,0 +1,32 @@
+package mqtt
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//nolint:gochecknoglobals
+var (
+	publishes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_receiver_mqtt_publishes_total",
+		Help: "The publishes to the MQTT broker, by result.",
+	}, []string{"result"})
+
+	publishesEnqueued = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "signal_receiver_mqtt_publishes_enqueued_total",
+		Help: "The publishes queued while the connection to the MQTT broker was down.",
+	})
+)
+
+// countPublish counts the result of a publish, enqueued is true if it was
+// queued because the connection was down.
+func countPublish(enqueued bool, err error) {
+	switch {
+	case err != nil:
+		publishes.WithLabelValues("failure").Inc()
+	case enqueued:
+		publishesEnqueued.Inc()
+	default:
+		publishes.WithLabelValues("success").Inc()
+	}
+}
@@ -0,0 +1,26 @@
+//nolint:testpackage
+package mqtt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountPublish(t *testing.T) {
+	t.Parallel()
+
+	success := testutil.ToFloat64(publishes.WithLabelValues("success"))
+	failure := testutil.ToFloat64(publishes.WithLabelValues("failure"))
+	enqueued := testutil.ToFloat64(publishesEnqueued)
+
+	countPublish(false, nil)
+	countPublish(true, nil)
+	countPublish(true, errors.New("queue is full")) //nolint:err113
+
+	assert.InDelta(t, success+1, testutil.ToFloat64(publishes.WithLabelValues("success")), 0)
+	assert.InDelta(t, failure+1, testutil.ToFloat64(publishes.WithLabelValues("failure")), 0)
+	assert.InDelta(t, enqueued+1, testutil.ToFloat64(publishesEnqueued), 0)
+}
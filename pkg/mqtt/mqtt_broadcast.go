@@ -6,13 +6,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/autopaho/queue/memory"
 	"github.com/eclipse/paho.golang/paho"
 	"github.com/rs/zerolog"
 
@@ -26,6 +29,10 @@ var (
 
 	// ErrMqttConnectionFailed is thrown when waiting for connection has failed.
 	ErrMqttConnectionFailed = errors.New("mqtt connection error")
+
+	// ErrMqttPublishesPending is returned by Shutdown if the queued publishes
+	// were not all sent in time.
+	ErrMqttPublishesPending = errors.New("mqtt publishes are still queued")
 )
 
 type publishPayload struct {
@@ -36,9 +43,52 @@ type publishPayload struct {
 type handlerOpt struct {
 	Logger      zerolog.Logger
 	Config      *config.Config
+	Topics      *config.Topics
 	Manager     *autopaho.ConnectionManager
 	connState   int32
 	connStateMu sync.Mutex
+
+	// evicted is the eviction count that was last published, if any.
+	evicted          uint64
+	evictedPublished bool
+
+	// publishFn replaces the publishing to the Manager, it is only set by tests.
+	publishFn func(ctx context.Context, publishOptions *paho.Publish, enqueue bool) error
+}
+
+// Connection is the connection to the MQTT broker returned by Init.
+type Connection struct {
+	manager *autopaho.ConnectionManager
+	cfg     *config.Config
+	logger  zerolog.Logger
+
+	// queue holds the publishes made while the broker was unreachable.
+	queue *memory.Queue
+
+	connected atomic.Bool
+}
+
+// Connected reports whether the connection to the MQTT broker is up.
+func (c *Connection) Connected() bool { return c.connected.Load() }
+
+// Shutdown waits for the publishes queued while the broker was unreachable to
+// be sent, publishes the offline state and disconnects from the broker. The
+// queued publishes that are not sent by the time ctx is done are lost.
+func (c *Connection) Shutdown(ctx context.Context) error {
+	var err error
+
+	select {
+	case <-c.queue.WaitForEmpty():
+	case <-ctx.Done():
+		err = fmt.Errorf("%w: %w", ErrMqttPublishesPending, ctx.Err())
+	}
+
+	// the will message is not sent on a clean disconnect.
+	if c.Connected() {
+		publishOnlineState(ctx, c.manager, c.cfg, false)
+	}
+
+	return errors.Join(err, c.manager.Disconnect(ctx))
 }
 
 const (
@@ -47,11 +97,9 @@ const (
 	connStateOnline  int32 = 1
 )
 
-func Init(
-	ctx context.Context,
-	notifier *receiver.Notifier,
-	options config.InitOptions,
-) error {
+// Init connects to the MQTT broker, the messages are published once Broadcast
+// is called with the notifier of a client.
+func Init(ctx context.Context, options config.InitOptions) (*Connection, error) {
 	logger := *zerolog.Ctx(ctx)
 	logger = logger.With().Str("scope", "MQTT").Logger()
 
@@ -63,10 +111,11 @@ func Init(
 	if err != nil {
 		logger.Error().Err(err).Msgf("Error while parsing the server url %s", options.Server)
 
-		return err
+		return nil, err
 	}
 
 	cfg := config.New(options)
+	c := &Connection{cfg: cfg, logger: logger, queue: memory.New()}
 
 	var conn *autopaho.ConnectionManager
 
@@ -94,6 +143,8 @@ func Init(
 				Str("clientID", options.ClientID).
 				Msg("Connection successfully established.")
 
+			c.connected.Store(true)
+
 			publishOnlineState(ctx, manager, cfg, true)
 		},
 		OnConnectionDown: func() bool {
@@ -101,6 +152,8 @@ func Init(
 				Str("clientID", options.ClientID).
 				Msg("Connection has been lost.")
 
+			c.connected.Store(false)
+
 			return true
 		},
 		OnConnectError: func(err error) {
@@ -115,6 +168,7 @@ func Init(
 			Payload: cfg.StatusOfflinePayload,
 		},
 		WillProperties: cfg.WillProperties,
+		Queue:          c.queue,
 		ClientConfig: paho.ClientConfig{
 			ClientID: options.ClientID,
 			OnClientError: func(err error) {
@@ -143,37 +197,46 @@ func Init(
 	})
 	// Initial connect will return unrecoverable Connack error
 	if err != nil {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"%w: error whilst attempting mqtt connection: %w",
 			ErrMqttConnectionAttempt,
 			err,
 		)
 	}
 
-	registerNotifier(ctx, notifier, &handlerOpt{
-		Logger:  logger,
-		Config:  cfg,
-		Manager: conn,
-	})
+	c.manager = conn
 
 	waitCtx, waitCancel := context.WithTimeout(ctx, cfg.ConnectionTimeoutInitial)
 	defer waitCancel()
 
 	if err = conn.AwaitConnection(waitCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
 		// The initial connection may be slow, but anything that cancels its context is unrecoverable for us too.
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"%w: mqtt error while waiting for connection: %w",
 			ErrMqttConnectionFailed,
 			err,
 		)
 	}
 
-	return nil
+	return c, nil
 }
 
-func registerNotifier(ctx context.Context, notifier *receiver.Notifier, options *handlerOpt) {
-	options.connState = connStateUnknown
-	notifier.RegisterHandler(ctx, options)
+// Broadcast publishes the messages and the state of the client of the notifier
+// to the broker. The topics include the account, they are not scoped if the
+// account is empty.
+func (c *Connection) Broadcast(ctx context.Context, notifier *receiver.Notifier, account string) {
+	logger := c.logger
+	if account != "" {
+		logger = logger.With().Str("account", account).Logger()
+	}
+
+	notifier.RegisterHandler(ctx, &handlerOpt{
+		Logger:    logger,
+		Config:    c.cfg,
+		Topics:    c.cfg.AccountTopics(account),
+		Manager:   c.manager,
+		connState: connStateUnknown,
+	})
 }
 
 func (m *handlerOpt) Handle(ctx context.Context, messagePayload receiver.NotifierPayload) error {
@@ -183,6 +246,14 @@ func (m *handlerOpt) Handle(ctx context.Context, messagePayload receiver.Notifie
 		err = m.publishMessage(ctx, messagePayload)
 	}
 
+	if messagePayload.Deleted != nil {
+		err = errors.Join(m.publishRemoteChange(ctx, m.Topics.Deleted, messagePayload.Deleted), err)
+	}
+
+	if messagePayload.Edited != nil {
+		err = errors.Join(m.publishRemoteChange(ctx, m.Topics.Edited, messagePayload.Edited), err)
+	}
+
 	desiredConnState := connStateOffline
 	if *messagePayload.IsConnected {
 		desiredConnState = connStateOnline
@@ -200,6 +271,16 @@ func (m *handlerOpt) Handle(ctx context.Context, messagePayload receiver.Notifie
 		}
 	}
 
+	if !m.evictedPublished || m.evicted != messagePayload.Evicted {
+		eErr := m.publishEvicted(ctx, messagePayload)
+		if eErr == nil {
+			m.evicted = messagePayload.Evicted
+			m.evictedPublished = true
+		} else {
+			err = errors.Join(eErr, err)
+		}
+	}
+
 	return err
 }
 
@@ -222,25 +303,76 @@ func (m *handlerOpt) publishMessage(ctx context.Context, mPayload receiver.Notif
 		return err
 	}
 
-	return publish(ctx, m.Manager, &paho.Publish{
+	// view-once messages are never retained, and disappearing messages expire
+	// on the broker at the same time they expire for the sender.
+	retain := m.Config.RetainMessages && !mPayload.Message.IsViewOnce()
+	properties := m.Config.PublishProperties
+
+	if expiresAt, ok := mPayload.Message.ExpiresAt(); ok {
+		expiry := uint32(max(math.Ceil(time.Until(expiresAt).Seconds()), 1))
+
+		withExpiry := *properties
+		withExpiry.MessageExpiry = &expiry
+		properties = &withExpiry
+	}
+
+	return m.publish(ctx, &paho.Publish{
 		QoS:        m.Config.Qos,
-		Topic:      m.Config.Topics.Message,
-		Retain:     m.Config.RetainMessages,
+		Topic:      m.Topics.Message,
+		Retain:     retain,
+		Properties: properties,
+		Payload:    payload,
+	}, true)
+}
+
+// publishRemoteChange publishes a remote delete or an edit of a message, they
+// are never retained.
+func (m *handlerOpt) publishRemoteChange(ctx context.Context, topic string, msg *receiver.Message) error {
+	payload, err := json.Marshal(publishPayload{Message: msg, Types: msg.MessageTypesStrings()})
+	if err != nil {
+		m.Logger.Error().Err(err).Msg("Error while marshaling message")
+
+		return err
+	}
+
+	return m.publish(ctx, &paho.Publish{
+		QoS:        m.Config.Qos,
+		Topic:      topic,
 		Properties: m.Config.PublishProperties,
 		Payload:    payload,
 	}, true)
 }
 
 func (m *handlerOpt) publishConnectionState(ctx context.Context, payload receiver.NotifierPayload) error {
-	return publish(ctx, m.Manager, &paho.Publish{
+	return m.publish(ctx, &paho.Publish{
 		QoS:        m.Config.StatusQosValue,
-		Topic:      m.Config.Topics.Connected,
+		Topic:      m.Topics.Connected,
 		Retain:     m.Config.StatusRetain,
 		Properties: m.Config.PublishProperties,
 		Payload:    m.Config.GetStatusPayloadForState(*payload.IsConnected),
 	}, true)
 }
 
+// publishEvicted publishes the number of messages evicted from the queue so
+// far, it is retained like the connection state.
+func (m *handlerOpt) publishEvicted(ctx context.Context, payload receiver.NotifierPayload) error {
+	return m.publish(ctx, &paho.Publish{
+		QoS:        m.Config.StatusQosValue,
+		Topic:      m.Topics.Evicted,
+		Retain:     m.Config.StatusRetain,
+		Properties: m.Config.PublishProperties,
+		Payload:    []byte(strconv.FormatUint(payload.Evicted, 10)),
+	}, true)
+}
+
+func (m *handlerOpt) publish(ctx context.Context, publishOptions *paho.Publish, enqueue bool) error {
+	if m.publishFn != nil {
+		return m.publishFn(ctx, publishOptions, enqueue)
+	}
+
+	return publish(ctx, m.Manager, publishOptions, enqueue)
+}
+
 func publishOnlineState(ctx context.Context, manager *autopaho.ConnectionManager, cfg *config.Config, state bool) {
 	_ = publish(ctx, manager, &paho.Publish{
 		QoS:        cfg.StatusQosValue,
@@ -259,7 +391,8 @@ func publish(
 ) error {
 	_, err := manager.Publish(ctx, publishOptions)
 
-	if enqueue && errors.Is(err, autopaho.ConnectionDownError) {
+	enqueued := enqueue && errors.Is(err, autopaho.ConnectionDownError)
+	if enqueued {
 		zerolog.Ctx(ctx).Debug().
 			AnErr("m", autopaho.ConnectionDownError).
 			Interface("id", publishOptions.PacketID).
@@ -269,6 +402,8 @@ func publish(
 		manager.Done()
 	}
 
+	countPublish(enqueued, err)
+
 	if err != nil {
 		zerolog.Ctx(ctx).Error().
 			Err(err).Msg("Error while publishing")
@@ -0,0 +1,96 @@
+//nolint:testpackage
+package mqtt
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/eclipse/paho.golang/paho"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/mqtt/config"
+	"github.com/kalbasit/signal-api-receiver/pkg/receiver"
+)
+
+func TestHandlePublishesEvicted(t *testing.T) {
+	t.Parallel()
+
+	var published []string
+
+	cfg := config.New(config.InitOptions{TopicPrefix: "signal"})
+
+	h := &handlerOpt{
+		Config:    cfg,
+		Topics:    cfg.Topics,
+		connState: connStateUnknown,
+		publishFn: func(_ context.Context, p *paho.Publish, _ bool) error {
+			published = append(published, p.Topic+"="+string(p.Payload))
+
+			return nil
+		},
+	}
+
+	for _, evicted := range []uint64{0, 0, 3, 3, 5} {
+		payload := receiver.PrepareNotifierPayload(nil, true)
+		payload.Evicted = evicted
+
+		if err := h.Handle(context.Background(), payload); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	want := []string{
+		"signal/connected=online",
+		"signal/evicted=0",
+		"signal/evicted=3",
+		"signal/evicted=5",
+	}
+
+	if !slices.Equal(want, published) {
+		t.Fatalf("expected %q to be published, got %q", want, published)
+	}
+}
+
+func TestHandlePublishesRemoteChanges(t *testing.T) {
+	t.Parallel()
+
+	var topics []string
+
+	cfg := config.New(config.InitOptions{TopicPrefix: "signal"})
+
+	h := &handlerOpt{
+		Config:           cfg,
+		Topics:           cfg.AccountTopics("+15550000001"),
+		connState:        connStateOnline,
+		evictedPublished: true,
+		publishFn: func(_ context.Context, p *paho.Publish, _ bool) error {
+			if p.Retain {
+				t.Errorf("expected %s not to be retained", p.Topic)
+			}
+
+			topics = append(topics, p.Topic)
+
+			return nil
+		},
+	}
+
+	payload := receiver.PrepareNotifierPayload(nil, true)
+	payload.Deleted = &receiver.Message{}
+
+	if err := h.Handle(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	payload = receiver.PrepareNotifierPayload(nil, true)
+	payload.Edited = &receiver.Message{}
+
+	if err := h.Handle(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := []string{"signal/15550000001/deleted", "signal/15550000001/edited"}
+
+	if !slices.Equal(want, topics) {
+		t.Fatalf("expected %q to be published, got %q", want, topics)
+	}
+}
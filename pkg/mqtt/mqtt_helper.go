@@ -50,6 +50,11 @@ func MakeClientID(localAddr *net.TCPAddr) string {
 }
 
 func interfaceForLocalAddr(netInterfaces []net.Interface, localAddr *net.TCPAddr) *net.Interface {
+	// e.g. the unix socket of the signal-cli daemon has no TCP address.
+	if localAddr == nil {
+		return nil
+	}
+
 	for _, netInterface := range netInterfaces {
 		netAddresses, err := netInterface.Addrs()
 		if err != nil {
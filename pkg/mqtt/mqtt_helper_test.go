@@ -33,6 +33,16 @@ func TestMakeRandomClientID(t *testing.T) {
 	}
 }
 
+func TestMakeClientIDWithoutLocalAddr(t *testing.T) {
+	t.Parallel()
+
+	clientID := mqtt.MakeClientID(nil)
+
+	if !strings.HasPrefix(clientID, config.ClientPrefix+"-") {
+		t.Fatalf("client ID should have prefix, got %q", clientID)
+	}
+}
+
 func TestValidateFlags(t *testing.T) {
 	t.Parallel()
 
@@ -3,52 +3,178 @@ package receiver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
-	"net/http"
 	"net/url"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
 )
 
+// ErrClientClosed is returned by Connect and ReceiveLoop once the client is
+// closed.
+var ErrClientClosed = errors.New("the client is closed")
+
+// closeTimeout bounds how long Close waits for the Signal API to echo the close
+// frame if its context has no deadline.
+const closeTimeout = 5 * time.Second
+
 // Client represents the Signal API client, and is returned by the New() function.
 type Client struct {
-	uri  *url.URL
-	conn *websocket.Conn
+	uri     *url.URL
+	account string
+
+	mode        Mode
+	dialer      *websocket.Dialer
+	dialOptions DialOptions
+
+	// poller polls the messages in ModePoll.
+	poller     *poller
+	pollPolicy PollPolicy
+
+	// conn is the websocket to the Signal API, stopped is closed when the
+	// receive loop reading from it returns.
+	connMu  sync.Mutex
+	conn    *websocket.Conn
+	rpcConn net.Conn
+	stopped chan struct{}
+	closed  bool
+
+	// closing is closed by Close to interrupt the reconnect delays.
+	closing chan struct{}
+
+	reconnectPolicy ReconnectPolicy
+	keepalivePolicy KeepalivePolicy
 
 	logger zerolog.Logger
 
 	recordedMessageTypesStrs []string
 	recordedMessageTypes     map[MessageType]bool
 
-	mu       sync.Mutex
-	messages []Message
+	store   MessageStore
+	limits  QueueLimits
+	evicted atomic.Uint64
+
+	dedup      *dedupIndex
+	duplicates atomic.Uint64
+
+	// recorded is closed, and replaced, every time a message is queued.
+	recordedMu sync.Mutex
+	recorded   chan struct{}
+
+	frames   broker[Frame]
+	messages broker[Message]
 
 	MessageNotifier *Notifier
 	notifierTrigger NotifierTrigger
 
 	connected atomic.Bool
+
+	// connectedAt is when the websocket connected, in Unix nanoseconds, or
+	// zero if it is disconnected.
+	connectedAt atomic.Int64
+
+	// lastFrameAt is when the last frame was received from the websocket, in
+	// Unix nanoseconds, or zero if none was received yet.
+	lastFrameAt atomic.Int64
+}
+
+// Options configures the Client returned by New().
+type Options struct {
+	// Account is the Signal account the client receives the messages of, it
+	// labels the metrics of the client.
+	Account string
+
+	// MessageTypes is the list of message types to record.
+	MessageTypes []string
+
+	// Store holds the recorded messages until they are consumed. A MemoryStore
+	// is used if no store is given.
+	Store MessageStore
+
+	// QueueLimits bounds the queue of recorded messages.
+	QueueLimits QueueLimits
+
+	// DedupWindow is how long an envelope is remembered to drop the duplicates
+	// of it, identified by sender, device and timestamp. Duplicates are not
+	// dropped if it is not positive.
+	DedupWindow time.Duration
+
+	// Consumers are the only consumers that may consume messages, they are
+	// declared up front so messages are kept for them even before they consumed
+	// their first message. The consumers of the store that are not listed are
+	// removed. Only DefaultConsumer is declared if the list is empty.
+	Consumers []string
+
+	// Reconnect configures how Run reconnects after the websocket dropped.
+	Reconnect ReconnectPolicy
+
+	// Keepalive configures how a dead websocket is detected.
+	Keepalive KeepalivePolicy
+
+	// Dial configures how the websocket to the Signal API is opened, or the
+	// HTTP connections in ModePoll. It does not apply to ModeDaemon.
+	Dial DialOptions
+
+	// Mode is how the messages are received from the Signal API.
+	Mode Mode
+
+	// Poll configures how the messages are polled in ModePoll.
+	Poll PollPolicy
 }
 
 // New creates a new Signal API client and returns it.
 // An error is returned if a websocket fails to open with the Signal's API
 // /v1/receive.
-func New(ctx context.Context, uri *url.URL, messageTypes ...string) (*Client, error) {
+func New(ctx context.Context, uri *url.URL, opts Options) (*Client, error) {
+	dialer, err := newDialer(opts.Dial)
+	if err != nil {
+		return nil, err
+	}
+
 	notifier, notifierTrigger := InitNotifier(ctx)
 
 	c := &Client{
 		uri:                      uri,
+		account:                  opts.Account,
+		mode:                     opts.Mode,
+		dialer:                   dialer,
+		dialOptions:              opts.Dial,
+		pollPolicy:               opts.Poll.withDefaults(),
 		logger:                   *zerolog.Ctx(ctx),
-		recordedMessageTypesStrs: messageTypes,
+		recordedMessageTypesStrs: opts.MessageTypes,
 		recordedMessageTypes:     make(map[MessageType]bool),
+		store:                    opts.Store,
+		limits:                   opts.QueueLimits,
 		MessageNotifier:          notifier,
 		notifierTrigger:          notifierTrigger,
+		closing:                  make(chan struct{}),
+		reconnectPolicy:          opts.Reconnect.withDefaults(),
+		keepalivePolicy:          opts.Keepalive.withDefaults(),
+	}
+
+	if c.store == nil {
+		c.store = NewMemoryStore(StoreOptions{})
+	}
+
+	if c.mode == ModePoll {
+		c.poller = newPoller(uri, dialer, c.pollPolicy)
+	}
+
+	if opts.DedupWindow > 0 {
+		c.dedup = newDedupIndex(opts.DedupWindow)
 	}
 
-	for _, mts := range messageTypes {
+	if err := c.declareConsumers(opts.Consumers); err != nil {
+		return nil, err
+	}
+
+	for _, mts := range opts.MessageTypes {
 		mt, err := ParseMessageType(mts)
 		if err != nil {
 			return nil, fmt.Errorf("could not parse message type %q: %w", mts, err)
@@ -64,6 +190,20 @@ func New(ctx context.Context, uri *url.URL, messageTypes ...string) (*Client, er
 }
 
 func (c *Client) Connect(ctx context.Context) error {
+	switch c.mode {
+	case ModePoll:
+		return c.connectPoll(ctx)
+	case ModeDaemon:
+		return c.connectDaemon(ctx)
+	}
+
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	if c.closed {
+		return ErrClientClosed
+	}
+
 	if c.conn != nil {
 		c.conn.Close()
 		c.conn = nil
@@ -71,7 +211,12 @@ func (c *Client) Connect(ctx context.Context) error {
 
 	c.logger.Info().Msg("Connecting to the Signal API")
 
-	conn, _, err := websocket.DefaultDialer.Dial(c.uri.String(), http.Header{})
+	header, err := c.dialOptions.header()
+	if err != nil {
+		return err
+	}
+
+	conn, _, err := c.dialer.Dial(c.uri.String(), header)
 	if err != nil {
 		return fmt.Errorf("error creating a new websocket connection: %w", err)
 	}
@@ -94,70 +239,378 @@ func (c *Client) Connect(ctx context.Context) error {
 // websocket and record them internally to be consumed by either Pop() or
 // Flush().
 func (c *Client) ReceiveLoop(ctx context.Context) error {
+	switch c.mode {
+	case ModePoll:
+		return c.pollLoop(ctx)
+	case ModeDaemon:
+		return c.daemonLoop(ctx)
+	}
+
 	log := c.logger.With().Str("func", "ReceiveLoop").Logger()
 
+	c.connMu.Lock()
+	conn := c.conn
+	stopped := make(chan struct{})
+	c.stopped = stopped
+	c.connMu.Unlock()
+
+	defer close(stopped)
+
 	log.
 		Info().
 		Strs("recorded-message-types", c.recordedMessageTypesStrs).
 		Msg("Starting the receive loop from Signal API")
 
+	var silent atomic.Bool
+
+	if c.keepalivePolicy.enabled() {
+		conn.SetPongHandler(func(string) error {
+			c.extendReadDeadline(conn)
+
+			return nil
+		})
+
+		c.extendReadDeadline(conn)
+
+		go c.keepalive(ctx, conn, stopped, &silent)
+	}
+
 	for {
-		_, msg, err := c.conn.ReadMessage()
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
 			c.setConnected(ctx, false)
+
+			if c.isClosed() {
+				log.Info().Msg("the websocket was closed")
+
+				return ErrClientClosed
+			}
+
+			switch {
+			case silent.Load():
+				err = fmt.Errorf("%w: %w", ErrMaxSilence, err)
+			case isTimeout(err):
+				keepaliveTimeouts.WithLabelValues(c.account, keepalivePong).Inc()
+
+				err = fmt.Errorf("%w: %w", ErrPongTimeout, err)
+			}
+
 			log.Error().Err(err).Msg("error returned by the websocket")
 
 			return err
 		}
 
+		c.extendReadDeadline(conn)
 		c.recordMessage(ctx, msg)
 	}
 }
 
+// Close closes the websocket to the Signal API cleanly: a close frame is sent,
+// and the connection is closed once the API echoed it or once ctx is done. The
+// client does not connect again once it is closed.
+func (c *Client) Close(ctx context.Context) error {
+	c.connMu.Lock()
+	if !c.closed && c.closing != nil {
+		close(c.closing)
+	}
+
+	c.closed = true
+	conn, rpcConn, stopped := c.conn, c.rpcConn, c.stopped
+	c.connMu.Unlock()
+
+	if rpcConn != nil {
+		if err := rpcConn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			return fmt.Errorf("error closing the connection to the signal-cli daemon: %w", err)
+		}
+	}
+
+	if conn == nil {
+		// in ModePoll and ModeDaemon, the receive loop was interrupted by
+		// closing the client.
+		if stopped != nil {
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+			}
+		}
+
+		return nil
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(closeTimeout)
+	}
+
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shutting down")
+	if err := conn.WriteControl(websocket.CloseMessage, msg, deadline); err == nil && stopped != nil {
+		// the receive loop returns once it reads the echoed close frame.
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+		}
+	}
+
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("error closing the websocket: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) isClosed() bool {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	return c.closed
+}
+
 func (c *Client) setConnected(ctx context.Context, isConnected bool) {
 	if c.connected.Swap(isConnected) == isConnected {
 		return
 	}
 
+	if isConnected {
+		c.connectedAt.Store(time.Now().UnixNano())
+		websocketConnects.WithLabelValues(c.account).Inc()
+	} else {
+		c.connectedAt.Store(0)
+		websocketDisconnects.WithLabelValues(c.account).Inc()
+	}
+
 	if c.notifierTrigger == nil {
 		return
 	}
 
-	if err := c.notifierTrigger(ctx, PrepareNotifierPayload(nil, isConnected)); err != nil {
+	if err := c.notifierTrigger(ctx, c.notifierPayload(nil, isConnected)); err != nil {
 		c.logger.Error().Err(err).Bool("isConnected", isConnected).Msg("error while handling notify trigger")
 	}
 }
 
-// Flush empties out the internal queue of messages and returns them.
-func (c *Client) Flush() []Message {
-	c.mu.Lock()
-	msgs := c.messages
-	c.messages = nil
-	c.mu.Unlock()
+// Account returns the Signal account the client receives the messages of.
+func (c *Client) Account() string { return c.account }
+
+// Connected reports whether the websocket to the Signal API is connected.
+func (c *Client) Connected() bool { return c.connected.Load() }
+
+// LastFrame returns when the last frame was received from the Signal API, or the
+// zero time if none was received yet.
+func (c *Client) LastFrame() time.Time {
+	lastFrameAt := c.lastFrameAt.Load()
+	if lastFrameAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, lastFrameAt)
+}
+
+// notifierPayload prepares a NotifierPayload that carries the client state.
+func (c *Client) notifierPayload(message *Message, isConnected bool) NotifierPayload {
+	payload := PrepareNotifierPayload(message, isConnected)
+	payload.Evicted = c.evicted.Load()
+
+	return payload
+}
+
+// Flush returns all the messages matching the filter that the consumer has not
+// consumed yet and consumes them.
+func (c *Client) Flush(consumer string, filter Filter) []Message {
+	c.pruneExpired()
+
+	msgs, err := c.store.Flush(consumer, filter.Match)
+	if err != nil {
+		c.logger.Error().Err(err).Str("consumer", consumer).Msg("error flushing the messages from the store")
+	}
 
 	return msgs
 }
 
-// Pop returns the oldest message in the queue or null if no message was found.
-func (c *Client) Pop() *Message {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Pop returns the oldest message matching the filter that the consumer has not
+// consumed yet, or null if no message was found.
+func (c *Client) Pop(consumer string, filter Filter) *Message {
+	c.pruneExpired()
 
-	if len(c.messages) == 0 {
-		return nil
+	msg, err := c.store.Pop(consumer, filter.Match)
+	if err != nil {
+		c.logger.Error().Err(err).Str("consumer", consumer).Msg("error popping a message from the store")
 	}
 
-	msg := c.messages[0]
-	c.messages = c.messages[1:]
+	return msg
+}
+
+// Recorded returns a channel that is closed the next time a message is queued.
+// Get the channel before looking for messages so none is missed.
+func (c *Client) Recorded() <-chan struct{} {
+	c.recordedMu.Lock()
+	defer c.recordedMu.Unlock()
+
+	if c.recorded == nil {
+		c.recorded = make(chan struct{})
+	}
+
+	return c.recorded
+}
+
+func (c *Client) signalRecorded() {
+	c.recordedMu.Lock()
+	defer c.recordedMu.Unlock()
+
+	if c.recorded != nil {
+		close(c.recorded)
+		c.recorded = nil
+	}
+}
+
+// Since returns up to limit of the messages recorded after the message with the
+// cursor ID without consuming them, including the consumed messages that are
+// still within the history retention.
+func (c *Client) Since(cursor uint64, limit int) []Message {
+	c.pruneExpired()
+
+	msgs, err := c.store.Since(cursor, limit)
+	if err != nil {
+		c.logger.Error().Err(err).Uint64("cursor", cursor).Msg("error reading the history from the store")
+	}
+
+	return msgs
+}
+
+// LastID returns the ID of the last message that was queued, or the ID
+// preceding the first one if none was queued yet.
+func (c *Client) LastID() uint64 {
+	id, err := c.store.LastID()
+	if err != nil {
+		c.logger.Error().Err(err).Msg("error reading the last ID from the store")
+	}
+
+	return id
+}
+
+// Peek returns up to limit of the oldest messages the consumer has not consumed
+// yet, without consuming them.
+func (c *Client) Peek(consumer string, limit int) []Message {
+	c.pruneExpired()
+
+	msgs, err := c.store.Peek(consumer, limit)
+	if err != nil {
+		c.logger.Error().Err(err).Str("consumer", consumer).Msg("error peeking at the messages in the store")
+	}
+
+	return msgs
+}
+
+// Count returns the number of messages the consumer has not consumed yet, and
+// how many of them have each message type. A message has several types, e.g. a
+// data-message is also a data message, so it is counted once for each.
+func (c *Client) Count(consumer string) (int, map[MessageType]int) {
+	types := make(map[MessageType]int)
+
+	msgs := c.Peek(consumer, 0)
+	for _, msg := range msgs {
+		for _, mt := range msg.MessageTypes() {
+			types[mt]++
+		}
+	}
+
+	return len(msgs), types
+}
+
+// Lease returns the oldest message the consumer has not consumed yet along with
+// a receipt handle, or null if no message was found. The message is hidden from
+// the consumer for the visibility timeout, it is consumed once the handle is
+// acked and is delivered again if it is not acked in time.
+func (c *Client) Lease(consumer string, timeout time.Duration) (*Message, string) {
+	c.pruneExpired()
+
+	msg, handle, err := c.store.Lease(consumer, timeout)
+	if err != nil {
+		c.logger.Error().Err(err).Str("consumer", consumer).Msg("error leasing a message from the store")
+	}
+
+	return msg, handle
+}
+
+// Ack consumes the message leased with the receipt handle. ErrLeaseNotFound is
+// returned if the handle is unknown or if the lease has expired.
+func (c *Client) Ack(handle string) error {
+	return c.store.Ack(handle)
+}
+
+// declareConsumers adds the consumers to the store and removes the consumers
+// of the store that are not declared, so a consumer that is gone does not keep
+// messages in the log forever.
+func (c *Client) declareConsumers(names []string) error {
+	if len(names) == 0 {
+		names = []string{DefaultConsumer}
+	}
+
+	for _, name := range names {
+		if err := ValidateConsumer(name); err != nil {
+			return fmt.Errorf("%w: %q", err, name)
+		}
+
+		if err := c.store.AddConsumer(name); err != nil {
+			return fmt.Errorf("error declaring the consumer %q: %w", name, err)
+		}
+	}
+
+	existing, err := c.store.Consumers()
+	if err != nil {
+		return fmt.Errorf("error listing the consumers: %w", err)
+	}
+
+	for _, name := range existing {
+		if slices.Contains(names, name) {
+			continue
+		}
+
+		c.logger.Info().Str("consumer", name).Msg("removing a consumer that is no longer declared")
+
+		if err := c.store.RemoveConsumer(name); err != nil {
+			return fmt.Errorf("error removing the consumer %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// HasConsumer reports whether the consumer exists.
+func (c *Client) HasConsumer(name string) bool {
+	names, err := c.store.Consumers()
+	if err != nil {
+		c.logger.Error().Err(err).Msg("error listing the consumers")
 
-	return &msg
+		return false
+	}
+
+	return slices.Contains(names, name)
+}
+
+// RemoveConsumer removes the consumer so messages are no longer kept for it.
+// ErrConsumerNotFound is returned if the consumer does not exist.
+func (c *Client) RemoveConsumer(name string) error {
+	return c.store.RemoveConsumer(name)
 }
 
 // LocalAddr returns connection local address.
 func (c *Client) LocalAddr() *net.TCPAddr {
-	addr, ok := c.conn.LocalAddr().(*net.TCPAddr)
+	if c.mode == ModePoll {
+		return c.poller.localAddr.Load()
+	}
+
+	var localAddr net.Addr
+
+	c.connMu.Lock()
+	if c.mode == ModeDaemon {
+		localAddr = c.rpcConn.LocalAddr()
+	} else {
+		localAddr = c.conn.LocalAddr()
+	}
+	c.connMu.Unlock()
+
+	addr, ok := localAddr.(*net.TCPAddr)
 	if !ok {
-		c.logger.Warn().Msgf("local address is not a TCP address: %T", c.conn.LocalAddr())
+		c.logger.Warn().Msgf("local address is not a TCP address: %T", localAddr)
 
 		return nil
 	}
@@ -166,6 +619,8 @@ func (c *Client) LocalAddr() *net.TCPAddr {
 }
 
 func (c *Client) recordMessage(ctx context.Context, msg []byte) {
+	c.lastFrameAt.Store(time.Now().UnixNano())
+
 	var m Message
 	if err := json.Unmarshal(msg, &m); err != nil {
 		c.logger.
@@ -174,6 +629,22 @@ func (c *Client) recordMessage(ctx context.Context, msg []byte) {
 			Str("signal-message", string(msg)).
 			Msg("error decoding the message")
 
+		decodeErrors.Inc()
+
+		return
+	}
+
+	c.frames.publish(Frame{Account: m.Account, Data: msg})
+
+	countReceived(m)
+
+	// a remote change delivered twice would be applied twice, e.g. an edit
+	// would override a later edit, so the duplicates are dropped first.
+	if isRemoteChange(m) {
+		if !c.dropDuplicate(m) {
+			c.applyRemoteChange(ctx, m)
+		}
+
 		return
 	}
 
@@ -192,18 +663,48 @@ func (c *Client) recordMessage(ctx context.Context, msg []byte) {
 				Msg("ignoring non-data message")
 		}
 
+		countIgnored(m, ignoredMessageType)
+
 		return
 	}
 
-	c.mu.Lock()
-	c.messages = append(c.messages, m)
-	c.mu.Unlock()
+	if m.IsExpired(time.Now()) {
+		c.logger.
+			Info().
+			Strs("message-types", m.MessageTypesStrings()).
+			Msg("ignoring a disappearing message that has already expired")
 
-	err := c.notifierTrigger(ctx, PrepareNotifierPayload(&m, true))
+		countIgnored(m, ignoredExpired)
+
+		return
+	}
+
+	if c.dropDuplicate(m) {
+		return
+	}
+
+	queued := c.makeRoom()
+	if queued {
+		if err := c.store.Append(&m); err != nil {
+			c.logger.Error().Err(err).Msg("error appending the message to the store")
+		} else {
+			countRecorded(m)
+			c.messages.publish(m)
+			c.signalRecorded()
+		}
+	} else {
+		countIgnored(m, ignoredQueueFull)
+	}
+
+	err := c.notifierTrigger(ctx, c.notifierPayload(&m, true))
 	if err != nil {
 		c.logger.Error().Err(err).Msg("error while handling new-message")
 	}
 
+	if !queued {
+		return
+	}
+
 	//nolint:zerologlint
 	if c.logger.Debug().Enabled() {
 		c.logger.
@@ -234,7 +735,7 @@ func (c *Client) notifyLoop(ctx context.Context) {
 		if hc := <-c.MessageNotifier.HandlersRegistered(); hc > 0 {
 			isConnected := c.connected.Load()
 
-			if err := c.notifierTrigger(ctx, PrepareNotifierPayload(nil, isConnected)); err != nil {
+			if err := c.notifierTrigger(ctx, c.notifierPayload(nil, isConnected)); err != nil {
 				c.logger.Error().Err(err).Bool("isConnected", isConnected).Msg("error while handling notify trigger")
 			}
 		}
@@ -23,82 +23,263 @@ var logger = zerolog.New(io.Discard)
 func TestFlush(t *testing.T) {
 	t.Parallel()
 
-	t.Run("returns empty list when no messages was found", func(t *testing.T) {
-		t.Parallel()
+	for name, newStore := range storeBackends() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			t.Run("returns empty list when no messages was found", func(t *testing.T) {
+				t.Parallel()
+
+				c := &Client{logger: logger, store: newStore(t)}
+				assert.Equal(t, []Message{}, c.Flush(DefaultConsumer, Filter{}))
+			})
+
+			t.Run("return the message if only one is there", func(t *testing.T) {
+				t.Parallel()
+
+				c := &Client{logger: logger, store: newStore(t, Message{Account: "1"})}
+
+				assert.Equal(t, []Message{{ID: 1, Account: "1"}}, c.Flush(DefaultConsumer, Filter{}))
+			})
+
+			t.Run("return messages in order", func(t *testing.T) {
+				t.Parallel()
+
+				c := &Client{
+					logger: logger,
+					store: newStore(t,
+						Message{Account: "0"},
+						Message{Account: "1"},
+						Message{Account: "2"},
+					),
+				}
+
+				want := []Message{
+					{ID: 1, Account: "0"},
+					{ID: 2, Account: "1"},
+					{ID: 3, Account: "2"},
+				}
+				got := c.Flush(DefaultConsumer, Filter{})
+
+				assert.Equal(t, want, got)
+			})
+		})
+	}
+}
 
-		c := &Client{logger: logger, messages: []Message{}}
-		assert.Equal(t, []Message{}, c.Flush())
-	})
+func TestPop(t *testing.T) {
+	t.Parallel()
 
-	t.Run("return the message if only one is there", func(t *testing.T) {
-		t.Parallel()
+	for name, newStore := range storeBackends() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-		c := &Client{logger: logger, messages: []Message{{Account: "1"}}}
+			t.Run("returns null when no messages was found", func(t *testing.T) {
+				t.Parallel()
 
-		assert.Equal(t, []Message{{Account: "1"}}, c.Flush())
-	})
+				c := &Client{logger: logger, store: newStore(t)}
 
-	t.Run("return messages in order", func(t *testing.T) {
-		t.Parallel()
+				var want *Message
 
-		c := &Client{
-			logger: logger,
-			messages: []Message{
-				{Account: "0"},
-				{Account: "1"},
-				{Account: "2"},
-			},
-		}
+				assert.Equal(t, want, c.Pop(DefaultConsumer, Filter{}))
+			})
 
-		want := []Message{
-			{Account: "0"},
-			{Account: "1"},
-			{Account: "2"},
-		}
-		got := c.Flush()
+			t.Run("return the message if only one is there", func(t *testing.T) {
+				t.Parallel()
 
-		assert.Equal(t, want, got)
-	})
+				c := &Client{logger: logger, store: newStore(t, Message{Account: "1"})}
+				want := Message{ID: 1, Account: "1"}
+				assert.Equal(t, want, *c.Pop(DefaultConsumer, Filter{}))
+			})
+
+			t.Run("return messages in order", func(t *testing.T) {
+				t.Parallel()
+
+				c := &Client{
+					logger: logger,
+					store: newStore(t,
+						Message{Account: "0"},
+						Message{Account: "1"},
+						Message{Account: "2"},
+					),
+				}
+
+				for i := range 3 {
+					want := Message{ID: uint64(i + 1), Account: strconv.Itoa(i)}
+					assert.Equal(t, want, *c.Pop(DefaultConsumer, Filter{}))
+				}
+			})
+		})
+	}
 }
 
-func TestPop(t *testing.T) {
+func TestRecorded(t *testing.T) {
 	t.Parallel()
 
-	t.Run("returns null when no messages was found", func(t *testing.T) {
+	c := newQueueClient(QueueLimits{MaxMessages: 1, OverflowPolicy: OverflowPolicyRefuse})
+
+	recorded := c.Recorded()
+
+	select {
+	case <-recorded:
+		t.Fatal("expected the channel to be open before a message is recorded")
+	default:
+	}
+
+	recordText(t, c, "0", 0)
+
+	select {
+	case <-recorded:
+	default:
+		t.Fatal("expected the channel to be closed once a message is recorded")
+	}
+
+	// a refused message is not queued, waiters are not woken up.
+	recorded = c.Recorded()
+
+	recordText(t, c, "1", 0)
+
+	select {
+	case <-recorded:
+		t.Fatal("expected the channel to be open if the message was not queued")
+	default:
+	}
+}
+
+func TestPeekAndCount(t *testing.T) {
+	t.Parallel()
+
+	c := newQueueClient(QueueLimits{})
+
+	recordText(t, c, "0", 0)
+	recordText(t, c, "1", 0)
+	require.NoError(t, c.store.Append(&Message{Envelope: Envelope{ReceiptMessage: &ReceiptMessage{}}}))
+
+	assert.Equal(t, []string{"0", "1"}, messageTexts(c.Peek(DefaultConsumer, 2)))
+
+	count, types := c.Count(DefaultConsumer)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, map[MessageType]int{
+		MessageTypeData:        2,
+		MessageTypeDataMessage: 2,
+		MessageTypeReceipt:     1,
+	}, types)
+
+	// neither peek nor count consume the messages.
+	assert.Len(t, c.Flush(DefaultConsumer, Filter{}), 3)
+}
+
+func TestDeclareConsumers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("the consumers that are not declared are removed", func(t *testing.T) {
 		t.Parallel()
 
-		c := &Client{logger: logger, messages: []Message{}}
+		store := NewMemoryStore(StoreOptions{})
+		require.NoError(t, store.AddConsumer("ha"))
+		require.NoError(t, store.AddConsumer("gone"))
+
+		c := &Client{logger: logger, store: store}
+		require.NoError(t, c.declareConsumers([]string{"ha", "node-red"}))
 
-		var want *Message
+		consumers, err := store.Consumers()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ha", "node-red"}, consumers)
 
-		assert.Equal(t, want, c.Pop())
+		assert.True(t, c.HasConsumer("node-red"))
+		assert.False(t, c.HasConsumer("gone"))
 	})
 
-	t.Run("return the message if only one is there", func(t *testing.T) {
+	t.Run("the default consumer is declared if none are", func(t *testing.T) {
 		t.Parallel()
 
-		c := &Client{logger: logger, messages: []Message{{Account: "1"}}}
-		want := Message{Account: "1"}
-		assert.Equal(t, want, *c.Pop())
+		c := &Client{logger: logger, store: NewMemoryStore(StoreOptions{})}
+		require.NoError(t, c.declareConsumers(nil))
+
+		consumers, err := c.store.Consumers()
+		require.NoError(t, err)
+		assert.Equal(t, []string{DefaultConsumer}, consumers)
 	})
 
-	t.Run("return messages in order", func(t *testing.T) {
+	t.Run("an invalid consumer is refused", func(t *testing.T) {
 		t.Parallel()
 
-		c := &Client{
-			logger: logger,
-			messages: []Message{
-				{Account: "0"},
-				{Account: "1"},
-				{Account: "2"},
-			},
+		c := &Client{logger: logger, store: NewMemoryStore(StoreOptions{})}
+		require.ErrorIs(t, c.declareConsumers([]string{"-typo"}), ErrInvalidConsumer)
+	})
+}
+
+func TestConnectedAndLastFrame(t *testing.T) {
+	t.Parallel()
+
+	c := newQueueClient(QueueLimits{})
+
+	assert.False(t, c.Connected())
+	assert.True(t, c.LastFrame().IsZero())
+
+	c.setConnected(t.Context(), true)
+	assert.True(t, c.Connected())
+
+	// every frame counts, even those that are not recorded.
+	before := time.Now()
+
+	c.recordMessage(t.Context(), []byte("not json"))
+	assert.False(t, c.LastFrame().Before(before))
+
+	c.setConnected(t.Context(), false)
+	assert.False(t, c.Connected())
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+
+	closed := make(chan int, 1)
+	trs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade websocket: %v", err)
+
+			return
 		}
+		defer conn.Close()
 
-		for i := range c.messages {
-			want := Message{Account: strconv.Itoa(i)}
-			assert.Equal(t, want, *c.Pop())
+		// the default close handler echoes the close frame.
+		_, _, err = conn.ReadMessage()
+
+		var closeErr *websocket.CloseError
+		if assert.ErrorAs(t, err, &closeErr) {
+			closed <- closeErr.Code
 		}
-	})
+	}))
+
+	defer trs.Close()
+
+	uri, err := url.Parse(trs.URL)
+	require.NoError(t, err)
+
+	uri.Scheme = "ws"
+
+	client, err := New(newContext(), uri, Options{})
+	require.NoError(t, err)
+	assert.True(t, client.Connected())
+
+	loopErr := make(chan error, 1)
+
+	go func() { loopErr <- client.ReceiveLoop(t.Context()) }()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, client.Close(ctx))
+
+	assert.Equal(t, websocket.CloseNormalClosure, <-closed)
+	require.ErrorIs(t, <-loopErr, ErrClientClosed)
+	assert.False(t, client.Connected())
+
+	// a closed client does not connect again.
+	require.ErrorIs(t, client.Connect(t.Context()), ErrClientClosed)
 }
 
 func TestRecordMessageTypes(t *testing.T) {
@@ -132,7 +313,7 @@ func TestRecordMessageTypes(t *testing.T) {
 
 	uri.Scheme = "ws"
 
-	client, err := New(newContext(), uri, MessageTypeDataMessage.String())
+	client, err := New(newContext(), uri, Options{MessageTypes: []string{MessageTypeDataMessage.String()}})
 	require.NoError(t, err)
 
 	go func(t *testing.T) {
@@ -147,7 +328,7 @@ func TestRecordMessageTypes(t *testing.T) {
 	)
 
 	// ensure no messages to pop at the beginning
-	assert.Nil(t, client.Pop())
+	assert.Nil(t, client.Pop(DefaultConsumer, Filter{}))
 
 	// send in a message that is a data message, what we are looking for
 	msgStr = "test1"
@@ -164,12 +345,13 @@ func TestRecordMessageTypes(t *testing.T) {
 	// wait for the messages to be recorded
 	time.Sleep(100 * time.Millisecond)
 
-	if rm := client.Pop(); assert.NotNil(t, rm) {
+	if rm := client.Pop(DefaultConsumer, Filter{}); assert.NotNil(t, rm) {
+		msg.ID = 1
 		assert.Equal(t, msg, *rm)
 	}
 
 	// now make sure the queue is empty again
-	assert.Nil(t, client.Pop())
+	assert.Nil(t, client.Pop(DefaultConsumer, Filter{}))
 
 	// send a new non-data message
 	ch <- Message{
@@ -181,7 +363,49 @@ func TestRecordMessageTypes(t *testing.T) {
 	// wait for the messages to be recorded or more specifically ignored
 	for i := 0; i < 3; i++ {
 		time.Sleep(100 * time.Millisecond)
-		assert.Nil(t, client.Pop())
+		assert.Nil(t, client.Pop(DefaultConsumer, Filter{}))
+	}
+}
+
+// storeBackends returns a constructor for each MessageStore implementation,
+// the returned store has the default consumer and is pre-filled with the given
+// messages.
+func storeBackends() map[string]func(*testing.T, ...Message) MessageStore {
+	return storeBackendsWithOptions(StoreOptions{})
+}
+
+// storeBackendsWithOptions is like storeBackends, the stores are created with
+// the given options.
+func storeBackendsWithOptions(opts StoreOptions) map[string]func(*testing.T, ...Message) MessageStore {
+	fill := func(t *testing.T, store MessageStore, msgs []Message) MessageStore {
+		t.Helper()
+
+		// New declares the default consumer if no consumers are given.
+		require.NoError(t, store.AddConsumer(DefaultConsumer))
+
+		for _, m := range msgs {
+			require.NoError(t, store.Append(&m))
+		}
+
+		return store
+	}
+
+	return map[string]func(*testing.T, ...Message) MessageStore{
+		"memory": func(t *testing.T, msgs ...Message) MessageStore {
+			t.Helper()
+
+			return fill(t, NewMemoryStore(opts), msgs)
+		},
+		"file": func(t *testing.T, msgs ...Message) MessageStore {
+			t.Helper()
+
+			store, err := NewFileStore(t.TempDir(), opts)
+			require.NoError(t, err)
+
+			t.Cleanup(func() { store.Close() })
+
+			return fill(t, store, msgs)
+		},
 	}
 }
 
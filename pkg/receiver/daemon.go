@@ -0,0 +1,178 @@
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// ErrDaemonScheme is returned if the URL of the signal-cli daemon is neither a
+// tcp:// nor a unix:// URL.
+var ErrDaemonScheme = errors.New("the signal-cli daemon URL must be tcp://<host>:<port> or unix://<path>")
+
+// methodReceive is the JSON-RPC notification carrying a message received by
+// signal-cli.
+const methodReceive = "receive"
+
+// rpcNotification is a JSON-RPC notification sent by the signal-cli daemon.
+type rpcNotification struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// receiveParams are the params of a receive notification that decide whether
+// it is recorded, the params are otherwise recorded as a Message.
+type receiveParams struct {
+	Account string `json:"account"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// daemonAddr returns the network and the address of the signal-cli daemon.
+func daemonAddr(uri *url.URL) (string, string, error) {
+	switch uri.Scheme {
+	case "tcp":
+		if uri.Host != "" {
+			return "tcp", uri.Host, nil
+		}
+	case "unix":
+		if path := uri.Host + uri.Path; path != "" {
+			return "unix", path, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("%w: %s", ErrDaemonScheme, uri)
+}
+
+// connectDaemon opens the connection to the signal-cli daemon.
+func (c *Client) connectDaemon(ctx context.Context) error {
+	network, addr, err := daemonAddr(c.uri)
+	if err != nil {
+		return err
+	}
+
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	if c.closed {
+		return ErrClientClosed
+	}
+
+	if c.rpcConn != nil {
+		c.rpcConn.Close()
+		c.rpcConn = nil
+	}
+
+	c.logger.Info().Str("network", network).Str("addr", addr).Msg("Connecting to the signal-cli daemon")
+
+	dialer := &net.Dialer{Timeout: handshakeTimeout}
+
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to the signal-cli daemon: %w", err)
+	}
+
+	c.rpcConn = conn
+
+	c.setConnected(ctx, true)
+
+	return nil
+}
+
+// daemonLoop is the ReceiveLoop of ModeDaemon, it records the messages of the
+// receive notifications sent by the signal-cli daemon until the connection
+// drops or the client is closed.
+func (c *Client) daemonLoop(ctx context.Context) error {
+	log := c.logger.With().Str("func", "ReceiveLoop").Logger()
+
+	c.connMu.Lock()
+	conn := c.rpcConn
+	stopped := make(chan struct{})
+	c.stopped = stopped
+	c.connMu.Unlock()
+
+	defer close(stopped)
+
+	log.
+		Info().
+		Strs("recorded-message-types", c.recordedMessageTypesStrs).
+		Msg("Starting the receive loop from the signal-cli daemon")
+
+	dec := json.NewDecoder(conn)
+
+	for {
+		var n rpcNotification
+		if err := dec.Decode(&n); err != nil {
+			c.setConnected(ctx, false)
+
+			if c.isClosed() {
+				log.Info().Msg("the connection to the signal-cli daemon was closed")
+
+				return ErrClientClosed
+			}
+
+			err = fmt.Errorf("error reading from the signal-cli daemon: %w", err)
+
+			log.Error().Err(err).Msg("error returned by the signal-cli daemon")
+
+			return err
+		}
+
+		if n.Method != methodReceive {
+			log.Debug().Str("method", n.Method).Msg("ignoring a JSON-RPC message that is not a receive notification")
+
+			continue
+		}
+
+		if msg, ok := c.receiveMessage(n.Params); ok {
+			c.recordMessage(ctx, msg)
+		}
+	}
+}
+
+// receiveMessage returns the message of the params of a receive notification,
+// and false if it is not recorded by the client: an error reported by
+// signal-cli, or a message of another account of a daemon serving several.
+func (c *Client) receiveMessage(params json.RawMessage) (json.RawMessage, bool) {
+	var p receiveParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		c.logger.Error().Err(err).Str("params", string(params)).Msg("error decoding a receive notification")
+
+		decodeErrors.Inc()
+
+		return nil, false
+	}
+
+	if p.Error != nil {
+		c.logger.Warn().Str("error", p.Error.Message).Msg("the signal-cli daemon failed to receive a message")
+
+		return nil, false
+	}
+
+	if c.account == "" || p.Account == c.account {
+		return params, true
+	}
+
+	if p.Account != "" {
+		return nil, false
+	}
+
+	// a daemon serving a single account may leave the account out.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(params, &fields); err != nil || fields == nil {
+		return params, true
+	}
+
+	fields["account"], _ = json.Marshal(c.account)
+
+	msg, err := json.Marshal(fields)
+	if err != nil {
+		return params, true
+	}
+
+	return msg, true
+}
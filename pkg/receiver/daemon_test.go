@@ -0,0 +1,206 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const daemonAccount = "+15551234567"
+
+// fakeDaemon listens as a signal-cli daemon on the network, and returns its URL
+// along with the connections it accepts.
+func fakeDaemon(t *testing.T, network string) (*url.URL, <-chan net.Conn) {
+	t.Helper()
+
+	var (
+		lis net.Listener
+		uri *url.URL
+		err error
+	)
+
+	switch network {
+	case "tcp":
+		lis, err = net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		uri = &url.URL{Scheme: "tcp", Host: lis.Addr().String()}
+	case "unix":
+		// t.TempDir may be too long for the path of a unix socket.
+		dir, err := os.MkdirTemp("", "signal-cli")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		lis, err = net.Listen("unix", filepath.Join(dir, "socket"))
+		require.NoError(t, err)
+
+		uri = &url.URL{Scheme: "unix", Path: lis.Addr().String()}
+	}
+
+	t.Cleanup(func() { lis.Close() })
+
+	conns := make(chan net.Conn, 10)
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			t.Cleanup(func() { conn.Close() })
+
+			conns <- conn
+		}
+	}()
+
+	return uri, conns
+}
+
+// notify sends a JSON-RPC notification with the params to the client.
+func notify(t *testing.T, conn net.Conn, method string, params any) {
+	t.Helper()
+
+	assert.NoError(t, json.NewEncoder(conn).Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}))
+}
+
+// receiveNotification returns the params of a receive notification of a data
+// message with the text for the account, which is left out if it is empty.
+func receiveNotification(account, text string) map[string]any {
+	params := map[string]any{
+		"envelope": Envelope{Source: "+15557654321", DataMessage: &DataMessage{Message: &text}},
+	}
+
+	if account != "" {
+		params["account"] = account
+	}
+
+	return params
+}
+
+func newDaemonClient(t *testing.T, uri *url.URL, opts Options) *Client {
+	t.Helper()
+
+	opts.Account = daemonAccount
+	opts.Mode = ModeDaemon
+	opts.MessageTypes = []string{MessageTypeDataMessage.String()}
+
+	client, err := New(newContext(), uri, opts)
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestDaemon(t *testing.T) {
+	t.Parallel()
+
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run("records the receive notifications over "+network, func(t *testing.T) {
+			t.Parallel()
+
+			uri, conns := fakeDaemon(t, network)
+			client := newDaemonClient(t, uri, Options{})
+
+			assert.True(t, client.Connected())
+
+			frames, stop := client.SubscribeFrames()
+			defer stop()
+
+			loopErr := make(chan error, 1)
+
+			go func() { loopErr <- client.ReceiveLoop(t.Context()) }()
+
+			conn := <-conns
+
+			notify(t, conn, "receive", receiveNotification(daemonAccount, "first"))
+			notify(t, conn, "receive", receiveNotification("+15550000000", "another account"))
+			notify(t, conn, "receive", map[string]any{
+				"account": daemonAccount,
+				"error":   map[string]any{"message": "Failed to decrypt the message"},
+			})
+			notify(t, conn, "listAccounts", nil)
+			notify(t, conn, "receive", receiveNotification("", "second"))
+
+			require.Eventually(t, func() bool {
+				count, _ := client.Count(DefaultConsumer)
+
+				return count == 2
+			}, 5*time.Second, 10*time.Millisecond)
+
+			msgs := client.Flush(DefaultConsumer, Filter{})
+			assert.Equal(t, []string{"first", "second"}, messageTexts(msgs))
+
+			for _, msg := range msgs {
+				assert.Equal(t, daemonAccount, msg.Account)
+				assert.Equal(t, "+15557654321", msg.Envelope.Source)
+			}
+
+			// the frames re-broadcast on the websocket carry the account.
+			for _, text := range []string{"first", "second"} {
+				f := <-frames
+				assert.Equal(t, daemonAccount, f.Account)
+				assert.Contains(t, string(f.Data), text)
+			}
+
+			require.NoError(t, client.Close(t.Context()))
+			require.ErrorIs(t, <-loopErr, ErrClientClosed)
+			assert.False(t, client.Connected())
+		})
+	}
+
+	t.Run("reconnects when the daemon drops the connection", func(t *testing.T) {
+		t.Parallel()
+
+		uri, conns := fakeDaemon(t, "tcp")
+		client := newDaemonClient(t, uri, Options{Reconnect: ReconnectPolicy{InitialDelay: time.Millisecond}})
+
+		ctx, cancel := context.WithCancel(t.Context())
+		runErr := make(chan error, 1)
+
+		go func() { runErr <- client.Run(ctx) }()
+
+		conn := <-conns
+		notify(t, conn, "receive", receiveNotification(daemonAccount, "before"))
+		conn.Close()
+
+		conn = <-conns
+		notify(t, conn, "receive", receiveNotification(daemonAccount, "after"))
+
+		require.Eventually(t, func() bool {
+			count, _ := client.Count(DefaultConsumer)
+
+			return count == 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.NotNil(t, client.LocalAddr())
+
+		cancel()
+
+		require.ErrorIs(t, <-runErr, context.Canceled)
+	})
+
+	t.Run("fails with an unsupported scheme", func(t *testing.T) {
+		t.Parallel()
+
+		for _, uri := range []string{"ws://localhost:8080", "tcp://", "unix://"} {
+			u, err := url.Parse(uri)
+			require.NoError(t, err)
+
+			_, err = New(newContext(), u, Options{Mode: ModeDaemon})
+			require.ErrorIs(t, err, ErrDaemonScheme, uri)
+		}
+	})
+}
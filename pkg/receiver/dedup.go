@@ -0,0 +1,99 @@
+package receiver
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultDedupWindow is how long an envelope is remembered to drop its
+// duplicates.
+const DefaultDedupWindow = 10 * time.Minute
+
+// dedupKey identifies an envelope: the sender, its device and the timestamp at
+// which it was sent.
+type dedupKey struct {
+	sender    string
+	device    int
+	timestamp int64
+}
+
+// dedupEntry is an envelope remembered by the dedupIndex, along with the time
+// at which it was recorded.
+type dedupEntry struct {
+	key dedupKey
+	at  time.Time
+}
+
+// dedupIndex remembers the envelopes recorded within the window so duplicates
+// delivered again by the Signal API, e.g. after a reconnect, can be dropped.
+type dedupIndex struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[dedupKey]struct{}
+
+	// order holds the envelopes in seen, oldest first, so the expired ones are
+	// found without going over the whole index.
+	order []dedupEntry
+}
+
+func newDedupIndex(window time.Duration) *dedupIndex {
+	return &dedupIndex{window: window, seen: make(map[dedupKey]struct{})}
+}
+
+// duplicate records the envelope of the message and reports whether it was
+// already recorded within the window. Envelopes without a sender or a timestamp
+// are never considered duplicates.
+func (d *dedupIndex) duplicate(m Message, now time.Time) bool {
+	sender := m.Author()
+	if sender == "" || m.Envelope.Timestamp == 0 {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(now)
+
+	key := dedupKey{sender: sender, device: m.Envelope.SourceDevice, timestamp: m.Envelope.Timestamp}
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+
+	d.seen[key] = struct{}{}
+	d.order = append(d.order, dedupEntry{key: key, at: now})
+
+	return false
+}
+
+// expire forgets the envelopes that were recorded a window ago or earlier.
+func (d *dedupIndex) expire(now time.Time) {
+	for len(d.order) > 0 && now.Sub(d.order[0].at) >= d.window {
+		delete(d.seen, d.order[0].key)
+
+		// clear the entry so the backing array does not keep the sender alive.
+		d.order[0] = dedupEntry{}
+		d.order = d.order[1:]
+	}
+}
+
+// dropDuplicate reports whether the message is a duplicate of an envelope
+// recorded within the dedup window, and accounts for it if it is.
+func (c *Client) dropDuplicate(m Message) bool {
+	if c.dedup == nil || !c.dedup.duplicate(m, time.Now()) {
+		return false
+	}
+
+	c.logger.
+		Info().
+		Str("source", m.Envelope.SourceUUID).
+		Int64("timestamp", m.Envelope.Timestamp).
+		Uint64("duplicates-total", c.duplicates.Add(1)).
+		Msg("dropping a duplicate envelope")
+
+	countIgnored(m, ignoredDuplicate)
+
+	return true
+}
+
+// Duplicates returns the number of duplicate envelopes that were dropped.
+func (c *Client) Duplicates() uint64 { return c.duplicates.Load() }
@@ -0,0 +1,96 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedup(t *testing.T) {
+	t.Parallel()
+
+	t.Run("duplicate envelopes are dropped before they are queued or notified", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{})
+		c.dedup = newDedupIndex(time.Minute)
+
+		var notified int
+
+		c.notifierTrigger = func(_ context.Context, payload NotifierPayload) error {
+			if payload.Message != nil {
+				notified++
+			}
+
+			return nil
+		}
+
+		now := time.Now().UnixMilli()
+
+		recordEnvelope(t, c, "0", Envelope{SourceUUID: "alice", SourceDevice: 1, Timestamp: now})
+		recordEnvelope(t, c, "1", Envelope{SourceUUID: "alice", SourceDevice: 1, Timestamp: now})
+		recordEnvelope(t, c, "2", Envelope{SourceUUID: "alice", SourceDevice: 2, Timestamp: now})
+		recordEnvelope(t, c, "3", Envelope{SourceUUID: "bob", SourceDevice: 1, Timestamp: now})
+		recordEnvelope(t, c, "4", Envelope{SourceUUID: "alice", SourceDevice: 1, Timestamp: now + 1})
+
+		assert.Equal(t, []string{"0", "2", "3", "4"}, messageTexts(c.Flush(DefaultConsumer, Filter{})))
+		assert.Equal(t, 4, notified)
+		assert.Equal(t, uint64(1), c.Duplicates())
+	})
+
+	t.Run("envelopes are forgotten after the window", func(t *testing.T) {
+		t.Parallel()
+
+		d := newDedupIndex(time.Minute)
+		m := Message{Envelope: Envelope{SourceUUID: "alice", Timestamp: 1}}
+		now := time.Now()
+
+		assert.False(t, d.duplicate(m, now))
+		assert.True(t, d.duplicate(m, now.Add(30*time.Second)))
+		assert.False(t, d.duplicate(m, now.Add(2*time.Minute)))
+	})
+
+	t.Run("only the envelopes within the window are remembered", func(t *testing.T) {
+		t.Parallel()
+
+		d := newDedupIndex(time.Minute)
+		now := time.Now()
+
+		for i := range 100 {
+			d.duplicate(Message{Envelope: Envelope{SourceUUID: "alice", Timestamp: int64(i + 1)}}, now)
+		}
+
+		d.duplicate(Message{Envelope: Envelope{SourceUUID: "bob", Timestamp: 1}}, now.Add(time.Minute))
+
+		assert.Len(t, d.seen, 1)
+		assert.Len(t, d.order, 1)
+	})
+
+	t.Run("envelopes without a sender or a timestamp are kept", func(t *testing.T) {
+		t.Parallel()
+
+		d := newDedupIndex(time.Minute)
+		now := time.Now()
+
+		for _, m := range []Message{{}, {Envelope: Envelope{SourceUUID: "alice"}}} {
+			assert.False(t, d.duplicate(m, now))
+			assert.False(t, d.duplicate(m, now))
+		}
+	})
+}
+
+func recordEnvelope(t *testing.T, c *Client, text string, envelope Envelope) {
+	t.Helper()
+
+	envelope.DataMessage = &DataMessage{Message: &text}
+
+	msg, err := json.Marshal(Message{Envelope: envelope})
+	require.NoError(t, err)
+
+	c.recordMessage(t.Context(), msg)
+}
@@ -0,0 +1,122 @@
+package receiver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrNoCA is returned by New if the CA file holds no certificate.
+var ErrNoCA = errors.New("no certificate found in the CA file")
+
+// handshakeTimeout bounds the time the websocket handshake with the Signal API
+// takes.
+const handshakeTimeout = 45 * time.Second
+
+// DialOptions configures how the websocket to the Signal API is opened, e.g. to
+// reach a signal-cli-rest-api behind a reverse proxy that requires TLS client
+// certificates or an Authorization header. The HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY environment variables are honoured.
+type DialOptions struct {
+	// CAFile is a PEM encoded bundle of the CAs trusted along with the system
+	// ones, e.g. a private CA.
+	CAFile string
+
+	// CertFile and KeyFile are the PEM encoded client certificate and key
+	// presented to the Signal API. They are loaded again on every handshake,
+	// so rotated certificates are picked up without a restart.
+	CertFile string
+	KeyFile  string
+
+	// InsecureSkipVerify does not verify the certificate of the Signal API.
+	InsecureSkipVerify bool
+
+	// Header is sent with the websocket handshake.
+	Header http.Header
+
+	// HeaderFiles maps the names of the headers sent with the handshake to
+	// the files holding their values, e.g. Authorization to a mounted secret.
+	// The files are read on every connect, their surrounding spaces trimmed.
+	HeaderFiles map[string]string
+}
+
+// newDialer returns the dialer opening the websocket as configured.
+func newDialer(opts DialOptions) (*websocket.Dialer, error) {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: handshakeTimeout,
+	}
+
+	if opts.CAFile == "" && opts.CertFile == "" && !opts.InsecureSkipVerify {
+		return dialer, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify, //nolint:gosec // it is opted into.
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the CA: %w", err)
+		}
+
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: %s", ErrNoCA, opts.CAFile)
+		}
+
+		tlsConfig.RootCAs = roots
+	}
+
+	if opts.CertFile != "" {
+		// fail early if the files cannot be loaded.
+		if _, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile); err != nil {
+			return nil, fmt.Errorf("error loading the client certificate: %w", err)
+		}
+
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("error loading the client certificate: %w", err)
+			}
+
+			return &cert, nil
+		}
+	}
+
+	dialer.TLSClientConfig = tlsConfig
+
+	return dialer, nil
+}
+
+// header returns the headers sent with the websocket handshake.
+func (opts DialOptions) header() (http.Header, error) {
+	header := opts.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	for name, file := range opts.HeaderFiles {
+		value, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the %s header: %w", name, err)
+		}
+
+		header.Set(name, strings.TrimSpace(string(value)))
+	}
+
+	return header, nil
+}
@@ -0,0 +1,235 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to dir
+// and returns their paths along with the certificate.
+func writeClientCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "signal-api-receiver"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile, cert
+}
+
+// tlsAPI starts a Signal API served over TLS, requiring clientCA to sign the
+// client certificates unless it is nil, and returns its websocket URL, the file
+// holding its CA and the headers of the handshakes.
+func tlsAPI(t *testing.T, clientCA *x509.Certificate) (*url.URL, string, func() []http.Header) {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+
+	trs := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+
+		upgrader := websocket.Upgrader{}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA)
+
+		trs.TLS = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+		}
+	}
+
+	trs.StartTLS()
+	t.Cleanup(trs.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(
+		caFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: trs.Certificate().Raw}),
+		0o600,
+	))
+
+	uri, err := url.Parse(trs.URL)
+	require.NoError(t, err)
+
+	uri.Scheme = "wss"
+
+	return uri, caFile, func() []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return headers
+	}
+}
+
+func TestDial(t *testing.T) {
+	t.Parallel()
+
+	t.Run("trusts the CA and presents the client certificate", func(t *testing.T) {
+		t.Parallel()
+
+		certFile, keyFile, cert := writeClientCert(t, t.TempDir())
+		uri, caFile, _ := tlsAPI(t, cert)
+
+		client, err := New(newContext(), uri, Options{Dial: DialOptions{
+			CAFile:   caFile,
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		}})
+		require.NoError(t, err)
+
+		defer client.Close(t.Context()) //nolint:errcheck
+
+		assert.True(t, client.Connected())
+	})
+
+	t.Run("fails without the client certificate", func(t *testing.T) {
+		t.Parallel()
+
+		_, _, cert := writeClientCert(t, t.TempDir())
+		uri, caFile, _ := tlsAPI(t, cert)
+
+		_, err := New(newContext(), uri, Options{Dial: DialOptions{CAFile: caFile}})
+		require.Error(t, err)
+	})
+
+	t.Run("fails with an unknown CA", func(t *testing.T) {
+		t.Parallel()
+
+		uri, _, _ := tlsAPI(t, nil)
+
+		_, err := New(newContext(), uri, Options{})
+
+		var unknown x509.UnknownAuthorityError
+		require.ErrorAs(t, err, &unknown)
+	})
+
+	t.Run("skips the verification if asked to", func(t *testing.T) {
+		t.Parallel()
+
+		uri, _, _ := tlsAPI(t, nil)
+
+		client, err := New(newContext(), uri, Options{Dial: DialOptions{InsecureSkipVerify: true}})
+		require.NoError(t, err)
+
+		defer client.Close(t.Context()) //nolint:errcheck
+
+		assert.True(t, client.Connected())
+	})
+
+	t.Run("fails with a CA file without certificate", func(t *testing.T) {
+		t.Parallel()
+
+		caFile := filepath.Join(t.TempDir(), "ca.crt")
+		require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+
+		_, err := New(newContext(), &url.URL{Scheme: "wss", Host: "localhost"}, Options{Dial: DialOptions{
+			CAFile: caFile,
+		}})
+		require.ErrorIs(t, err, ErrNoCA)
+	})
+
+	t.Run("sends the headers, reading the files on every connect", func(t *testing.T) {
+		t.Parallel()
+
+		uri, caFile, headers := tlsAPI(t, nil)
+
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(tokenFile, []byte("Bearer first\n"), 0o600))
+
+		client, err := New(newContext(), uri, Options{Dial: DialOptions{
+			CAFile:      caFile,
+			Header:      http.Header{"X-Signal-Proxy": []string{"receiver"}},
+			HeaderFiles: map[string]string{"Authorization": tokenFile},
+		}})
+		require.NoError(t, err)
+
+		defer client.Close(t.Context()) //nolint:errcheck
+
+		require.NoError(t, os.WriteFile(tokenFile, []byte("Bearer second\n"), 0o600))
+		require.NoError(t, client.Connect(t.Context()))
+
+		got := headers()
+		require.Len(t, got, 2)
+		assert.Equal(t, "receiver", got[0].Get("X-Signal-Proxy"))
+		assert.Equal(t, "Bearer first", got[0].Get("Authorization"))
+		assert.Equal(t, "receiver", got[1].Get("X-Signal-Proxy"))
+		assert.Equal(t, "Bearer second", got[1].Get("Authorization"))
+	})
+
+	t.Run("fails if a header file is missing", func(t *testing.T) {
+		t.Parallel()
+
+		uri, caFile, _ := tlsAPI(t, nil)
+
+		_, err := New(newContext(), uri, Options{Dial: DialOptions{
+			CAFile:      caFile,
+			HeaderFiles: map[string]string{"Authorization": filepath.Join(t.TempDir(), "missing")},
+		}})
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,63 @@
+package receiver
+
+import (
+	"regexp"
+	"slices"
+)
+
+// Filter selects the messages to pop or flush, a message must match every field
+// that is set. The zero Filter matches every message.
+type Filter struct {
+	// Source matches the phone number of the sender.
+	Source string
+
+	// SourceUUID matches the UUID of the sender.
+	SourceUUID string
+
+	// GroupID matches the group the message was sent to.
+	GroupID string
+
+	// Types matches the messages that have any of the types.
+	Types []MessageType
+
+	// Text matches the text of the message.
+	Text *regexp.Regexp
+
+	// HasAttachment matches the messages that have attachments, or that have
+	// none if it is false.
+	HasAttachment *bool
+}
+
+// Match returns true if the message matches the filter.
+func (f Filter) Match(m Message) bool {
+	env := m.Envelope
+	dm := env.DataMessage
+
+	if f.Source != "" && env.Source != f.Source && env.SourceNumber != f.Source {
+		return false
+	}
+
+	if f.SourceUUID != "" && env.SourceUUID != f.SourceUUID {
+		return false
+	}
+
+	if f.GroupID != "" && (dm == nil || dm.GroupInfo == nil || dm.GroupInfo.GroupID != f.GroupID) {
+		return false
+	}
+
+	if len(f.Types) > 0 && !slices.ContainsFunc(m.MessageTypes(), func(mt MessageType) bool {
+		return slices.Contains(f.Types, mt)
+	}) {
+		return false
+	}
+
+	if f.Text != nil && (dm == nil || dm.Message == nil || !f.Text.MatchString(*dm.Message)) {
+		return false
+	}
+
+	if f.HasAttachment != nil && (dm != nil && len(dm.Attachments) > 0) != *f.HasAttachment {
+		return false
+	}
+
+	return true
+}
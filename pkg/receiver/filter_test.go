@@ -0,0 +1,68 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMatch(t *testing.T) {
+	t.Parallel()
+
+	text := "turn the lights on"
+	yes, no := true, false
+
+	msg := Message{Envelope: Envelope{
+		Source:       "+1",
+		SourceNumber: "+1",
+		SourceUUID:   "alice",
+		DataMessage: &DataMessage{
+			Message: &text,
+			GroupInfo: &struct {
+				GroupID   string `json:"groupId"`
+				GroupName string `json:"groupName"`
+				Revision  int64  `json:"revision"`
+				Type      string `json:"type"`
+			}{GroupID: "home"},
+			Attachments: []Attachment{{ID: "a"}},
+		},
+	}}
+
+	receipt := Message{Envelope: Envelope{Source: "+1", ReceiptMessage: &ReceiptMessage{}}}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		msg     Message
+		matches bool
+	}{
+		{"the zero filter matches everything", Filter{}, receipt, true},
+		{"source", Filter{Source: "+1"}, msg, true},
+		{"another source", Filter{Source: "+2"}, msg, false},
+		{"source uuid", Filter{SourceUUID: "alice"}, msg, true},
+		{"another source uuid", Filter{SourceUUID: "bob"}, msg, false},
+		{"group", Filter{GroupID: "home"}, msg, true},
+		{"another group", Filter{GroupID: "work"}, msg, false},
+		{"group of a message without one", Filter{GroupID: "home"}, receipt, false},
+		{"type", Filter{Types: []MessageType{MessageTypeDataMessage}}, msg, true},
+		{"any of the types", Filter{Types: []MessageType{MessageTypeTyping, MessageTypeReceipt}}, receipt, true},
+		{"another type", Filter{Types: []MessageType{MessageTypeReceipt}}, msg, false},
+		{"text", Filter{Text: regexp.MustCompile(`lights (on|off)`)}, msg, true},
+		{"another text", Filter{Text: regexp.MustCompile(`^lights`)}, msg, false},
+		{"text of a message without one", Filter{Text: regexp.MustCompile(`.*`)}, receipt, false},
+		{"has an attachment", Filter{HasAttachment: &yes}, msg, true},
+		{"has no attachment", Filter{HasAttachment: &no}, msg, false},
+		{"has no attachment without a data message", Filter{HasAttachment: &no}, receipt, true},
+		{"every field must match", Filter{Source: "+1", SourceUUID: "bob"}, msg, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.matches, test.filter.Match(test.msg))
+		})
+	}
+}
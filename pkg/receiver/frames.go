@@ -0,0 +1,82 @@
+package receiver
+
+import "sync"
+
+// subscriberBuffer is the number of values buffered for a subscriber, a
+// subscriber that falls further behind is dropped.
+const subscriberBuffer = 64
+
+// Frame is a message as it was received from the Signal API, before it is
+// filtered and recorded.
+type Frame struct {
+	// Account is the account the message was received for.
+	Account string
+
+	// Data is the raw websocket frame.
+	Data []byte
+}
+
+// broker fans the values out to the subscribers, in the order they are
+// published.
+type broker[T any] struct {
+	mu          sync.Mutex
+	subscribers map[chan T]struct{}
+}
+
+func (b *broker[T]) subscribe() chan T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan T]struct{})
+	}
+
+	ch := make(chan T, subscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+
+	return ch
+}
+
+func (b *broker[T]) unsubscribe(ch chan T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *broker[T]) publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- v:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// SubscribeFrames returns a channel receiving a copy of every frame received
+// from the Signal API, whether it is recorded or not, and a function to stop
+// the subscription. The channel is closed when the subscription stops, or if
+// the subscriber falls too far behind.
+func (c *Client) SubscribeFrames() (<-chan Frame, func()) {
+	ch := c.frames.subscribe()
+
+	return ch, func() { c.frames.unsubscribe(ch) }
+}
+
+// SubscribeMessages returns a channel receiving every message once it is
+// queued, in the order they are queued, and a function to stop the
+// subscription. The channel is closed when the subscription stops, or if the
+// subscriber falls too far behind.
+func (c *Client) SubscribeMessages() (<-chan Message, func()) {
+	ch := c.messages.subscribe()
+
+	return ch, func() { c.messages.unsubscribe(ch) }
+}
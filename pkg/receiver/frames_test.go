@@ -0,0 +1,97 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribeFrames(t *testing.T) {
+	t.Parallel()
+
+	t.Run("every frame is copied to every subscriber", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{})
+
+		first, stopFirst := c.SubscribeFrames()
+		defer stopFirst()
+
+		second, stopSecond := c.SubscribeFrames()
+		defer stopSecond()
+
+		data := []byte(`{"account":"+1","envelope":{"typingMessage":{"action":"STARTED"}}}`)
+		c.recordMessage(t.Context(), data)
+
+		for _, ch := range []<-chan Frame{first, second} {
+			select {
+			case f := <-ch:
+				assert.Equal(t, Frame{Account: "+1", Data: data}, f)
+			default:
+				t.Fatal("expected a frame")
+			}
+		}
+
+		// the typing message was not recorded, it was only fanned out.
+		assert.Empty(t, c.Flush(DefaultConsumer, Filter{}))
+	})
+
+	t.Run("a stopped subscription is closed", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{})
+
+		ch, stop := c.SubscribeFrames()
+		stop()
+		stop()
+
+		_, ok := <-ch
+		assert.False(t, ok)
+	})
+
+	t.Run("a subscriber that falls behind is dropped", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{})
+
+		ch, stop := c.SubscribeFrames()
+		defer stop()
+
+		for range subscriberBuffer + 1 {
+			c.recordMessage(t.Context(), []byte(`{"account":"+1"}`))
+		}
+
+		n := 0
+		for range ch {
+			n++
+		}
+
+		require.Equal(t, subscriberBuffer, n)
+	})
+}
+
+func TestSubscribeMessages(t *testing.T) {
+	t.Parallel()
+
+	c := newQueueClient(QueueLimits{})
+
+	ch, stop := c.SubscribeMessages()
+	defer stop()
+
+	recordText(t, c, "0", 0)
+	c.recordMessage(t.Context(), []byte(`{"account":"+1","envelope":{"typingMessage":{"action":"STARTED"}}}`))
+	recordText(t, c, "1", 0)
+	stop()
+
+	var msgs []Message
+	for m := range ch {
+		msgs = append(msgs, m)
+	}
+
+	// only the queued messages are published, in order and with their ID.
+	assert.Equal(t, []string{"0", "1"}, messageTexts(msgs))
+	assert.Equal(t, uint64(1), msgs[0].ID)
+	assert.Equal(t, uint64(2), msgs[1].ID)
+}
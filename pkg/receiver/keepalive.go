@@ -0,0 +1,149 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrPongTimeout is returned by ReceiveLoop when the Signal API did not
+	// answer a ping in time, e.g. because a NAT dropped the connection.
+	ErrPongTimeout = errors.New("no pong was received from the Signal API in time")
+
+	// ErrMaxSilence is returned by ReceiveLoop when no message was received
+	// from the Signal API for longer than the maximum silence.
+	ErrMaxSilence = errors.New("no message was received from the Signal API for too long")
+)
+
+const (
+	// DefaultPingInterval is how often a ping is sent to the Signal API by
+	// default.
+	DefaultPingInterval = 30 * time.Second
+
+	// DefaultPongTimeout is how long the Signal API has to answer a ping by
+	// default.
+	DefaultPongTimeout = 10 * time.Second
+)
+
+// KeepalivePolicy configures how the client detects a websocket to the Signal
+// API that is no longer alive. The receive loop returns, the client is marked
+// as disconnected and Run reconnects once it is detected.
+type KeepalivePolicy struct {
+	// PingInterval is how often a ping is sent, zero to send none. Any frame,
+	// including the pongs, must be received within PingInterval plus
+	// PongTimeout or the websocket is considered dead.
+	PingInterval time.Duration
+
+	// PongTimeout is how long the Signal API has to answer a ping, zero for
+	// DefaultPongTimeout.
+	PongTimeout time.Duration
+
+	// MaxSilence is how long the Signal API may send no message before the
+	// websocket is considered stuck, zero to wait forever. The pongs do not
+	// count, so it catches an API that is alive but no longer delivers.
+	MaxSilence time.Duration
+}
+
+func (p KeepalivePolicy) withDefaults() KeepalivePolicy {
+	if p.PongTimeout <= 0 {
+		p.PongTimeout = DefaultPongTimeout
+	}
+
+	return p
+}
+
+func (p KeepalivePolicy) enabled() bool {
+	return p.PingInterval > 0 || p.MaxSilence > 0
+}
+
+// extendReadDeadline gives the Signal API until the next ping is answered to
+// send a frame.
+func (c *Client) extendReadDeadline(conn *websocket.Conn) {
+	if c.keepalivePolicy.PingInterval <= 0 {
+		return
+	}
+
+	deadline := time.Now().Add(c.keepalivePolicy.PingInterval + c.keepalivePolicy.PongTimeout)
+
+	//nolint:errcheck // the read fails too if the connection is broken.
+	conn.SetReadDeadline(deadline)
+}
+
+// isTimeout reports whether err is a read deadline that expired. The websocket
+// hides the deadline behind a net.Error of its own.
+func isTimeout(err error) bool {
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// keepalive pings the Signal API and watches for its silence until stopped is
+// closed. The connection is closed if the silence lasts too long, and silent is
+// set so the receive loop can tell why its read failed.
+func (c *Client) keepalive(ctx context.Context, conn *websocket.Conn, stopped <-chan struct{}, silent *atomic.Bool) {
+	started := time.Now()
+
+	var ping <-chan time.Time
+
+	if c.keepalivePolicy.PingInterval > 0 {
+		ticker := time.NewTicker(c.keepalivePolicy.PingInterval)
+		defer ticker.Stop()
+
+		ping = ticker.C
+	}
+
+	var (
+		watchdog *time.Timer
+		silence  <-chan time.Time
+	)
+
+	if c.keepalivePolicy.MaxSilence > 0 {
+		watchdog = time.NewTimer(c.keepalivePolicy.MaxSilence)
+		defer watchdog.Stop()
+
+		silence = watchdog.C
+	}
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ping:
+			deadline := time.Now().Add(c.keepalivePolicy.PongTimeout)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				// the read fails too if the websocket is dead.
+				c.logger.Debug().Err(err).Msg("error sending a ping to the Signal API")
+			}
+		case <-silence:
+			since := started
+			if lastFrame := c.LastFrame(); lastFrame.After(since) {
+				since = lastFrame
+			}
+
+			if remaining := c.keepalivePolicy.MaxSilence - time.Since(since); remaining > 0 {
+				watchdog.Reset(remaining)
+
+				continue
+			}
+
+			c.logger.
+				Warn().
+				Dur("max-silence", c.keepalivePolicy.MaxSilence).
+				Msg("no message was received from the Signal API for too long, reconnecting")
+
+			keepaliveTimeouts.WithLabelValues(c.account, keepaliveSilence).Inc()
+			silent.Store(true)
+			c.setConnected(ctx, false)
+
+			// unblock the receive loop.
+			conn.Close()
+
+			return
+		}
+	}
+}
@@ -0,0 +1,129 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keepaliveAPI returns a Signal API handler that reads from the websocket until
+// it drops, counting the pings and answering them if answer is set.
+func keepaliveAPI(pings *atomic.Int32, answer bool) func(int32, http.ResponseWriter, *http.Request) {
+	return func(_ int32, w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.SetPingHandler(func(data string) error {
+			pings.Add(1)
+
+			if !answer {
+				return nil
+			}
+
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	t.Parallel()
+
+	t.Run("stays connected while the pings are answered", func(t *testing.T) {
+		t.Parallel()
+
+		var pings atomic.Int32
+
+		client := newWebsocketClient(t, Options{Keepalive: KeepalivePolicy{
+			PingInterval: 10 * time.Millisecond,
+			PongTimeout:  50 * time.Millisecond,
+		}}, keepaliveAPI(&pings, true))
+
+		loopErr := make(chan error, 1)
+
+		go func() { loopErr <- client.ReceiveLoop(t.Context()) }()
+
+		require.Eventually(t, func() bool { return pings.Load() >= 10 }, 5*time.Second, 10*time.Millisecond)
+		assert.True(t, client.Connected())
+
+		require.NoError(t, client.Close(t.Context()))
+		require.ErrorIs(t, <-loopErr, ErrClientClosed)
+	})
+
+	t.Run("disconnects when the pings are not answered", func(t *testing.T) {
+		t.Parallel()
+
+		var pings atomic.Int32
+
+		client := newWebsocketClient(t, Options{Keepalive: KeepalivePolicy{
+			PingInterval: 10 * time.Millisecond,
+			PongTimeout:  10 * time.Millisecond,
+		}}, keepaliveAPI(&pings, false))
+
+		err := client.ReceiveLoop(t.Context())
+		require.ErrorIs(t, err, ErrPongTimeout)
+		assert.False(t, client.Connected())
+		assert.Positive(t, pings.Load())
+	})
+
+	t.Run("disconnects when no message is received for too long", func(t *testing.T) {
+		t.Parallel()
+
+		var pings atomic.Int32
+
+		client := newWebsocketClient(t, Options{Keepalive: KeepalivePolicy{
+			PingInterval: 10 * time.Millisecond,
+			MaxSilence:   100 * time.Millisecond,
+		}}, keepaliveAPI(&pings, true))
+
+		start := time.Now()
+
+		err := client.ReceiveLoop(t.Context())
+		require.ErrorIs(t, err, ErrMaxSilence)
+		assert.False(t, client.Connected())
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+		// the pongs do not count as messages.
+		assert.Positive(t, pings.Load())
+	})
+
+	t.Run("reconnects once the websocket is considered dead", func(t *testing.T) {
+		t.Parallel()
+
+		var pings atomic.Int32
+
+		client := newWebsocketClient(t, Options{
+			Keepalive: KeepalivePolicy{MaxSilence: 20 * time.Millisecond},
+			Reconnect: ReconnectPolicy{InitialDelay: time.Millisecond},
+		}, keepaliveAPI(&pings, true))
+
+		recorder := &reconnectRecorder{}
+		client.MessageNotifier.RegisterHandler(t.Context(), recorder)
+
+		runErr := make(chan error, 1)
+
+		go func() { runErr <- client.Run(t.Context()) }()
+
+		require.Eventually(t, func() bool { return len(recorder.sorted()) >= 2 }, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, client.Close(t.Context()))
+		require.ErrorIs(t, <-runErr, ErrClientClosed)
+		assert.Zero(t, pings.Load())
+	})
+}
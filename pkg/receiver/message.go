@@ -3,6 +3,7 @@ package receiver
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 // ErrMessageTypeUnknown is returned if message type (string) is not known.
@@ -81,6 +82,10 @@ func ParseMessageType(mt string) (MessageType, error) {
 
 // Message defines the message structure received from the Signal API.
 type Message struct {
+	// ID is assigned when the message is recorded, it increases with every
+	// recorded message.
+	ID uint64 `json:"id,omitempty"`
+
 	Account  string   `json:"account"`
 	Envelope Envelope `json:"envelope"`
 }
@@ -96,6 +101,7 @@ type Envelope struct {
 	ReceiptMessage *ReceiptMessage `json:"receiptMessage,omitempty"`
 	TypingMessage  *TypingMessage  `json:"typingMessage,omitempty"`
 	DataMessage    *DataMessage    `json:"dataMessage,omitempty"`
+	EditMessage    *EditMessage    `json:"editMessage,omitempty"`
 	SyncMessage    *struct{}       `json:"syncMessage,omitempty"`
 }
 
@@ -151,6 +157,12 @@ type DataMessage struct {
 	} `json:"remoteDelete,omitempty"`
 }
 
+// EditMessage represents an edit of a message sent before by the same author.
+type EditMessage struct {
+	TargetSentTimestamp int64        `json:"targetSentTimestamp"`
+	DataMessage         *DataMessage `json:"dataMessage"`
+}
+
 // Attachment defines the attachment structure of a message.
 type Attachment struct {
 	ContentType     string  `json:"contentType"`
@@ -190,6 +202,62 @@ func (m Message) MessageTypes() []MessageType {
 	return mts
 }
 
+// Author returns the sender of the message, its UUID if known.
+func (m Message) Author() string {
+	if m.Envelope.SourceUUID != "" {
+		return m.Envelope.SourceUUID
+	}
+
+	return m.Envelope.Source
+}
+
+// IsSentAt returns true if the message was sent by the author at the given
+// timestamp, which is how remote deletes and edits refer to a message.
+func (m Message) IsSentAt(author string, timestamp int64) bool {
+	if author == "" || m.Author() != author {
+		return false
+	}
+
+	if m.Envelope.Timestamp == timestamp {
+		return true
+	}
+
+	return m.Envelope.DataMessage != nil && m.Envelope.DataMessage.Timestamp == timestamp
+}
+
+// IsViewOnce returns true if the message is a view-once message.
+func (m Message) IsViewOnce() bool {
+	return m.Envelope.DataMessage != nil && m.Envelope.DataMessage.ViewOnce
+}
+
+// ExpiresAt returns the time at which a disappearing message expires, and false
+// if the message does not disappear.
+func (m Message) ExpiresAt() (time.Time, bool) {
+	dm := m.Envelope.DataMessage
+	if dm == nil || dm.ExpiresInSeconds <= 0 {
+		return time.Time{}, false
+	}
+
+	sentAt := m.Envelope.Timestamp
+	if sentAt == 0 {
+		sentAt = dm.Timestamp
+	}
+
+	if sentAt == 0 {
+		return time.Time{}, false
+	}
+
+	return time.UnixMilli(sentAt).Add(time.Duration(dm.ExpiresInSeconds) * time.Second), true
+}
+
+// IsExpired returns true if the message is a disappearing message that has
+// expired at the given time.
+func (m Message) IsExpired(now time.Time) bool {
+	expiresAt, ok := m.ExpiresAt()
+
+	return ok && !now.Before(expiresAt)
+}
+
 // MessageTypes returns the types of a message encoded as a string.
 func (m Message) MessageTypesStrings() []string {
 	mts := m.MessageTypes()
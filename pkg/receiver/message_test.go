@@ -2,6 +2,7 @@ package receiver_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -86,3 +87,41 @@ func TestMessageType(t *testing.T) {
 			m.MessageTypes())
 	})
 }
+
+func TestMessageExpiresAt(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not a disappearing message", func(t *testing.T) {
+		t.Parallel()
+
+		m := receiver.Message{
+			Envelope: receiver.Envelope{
+				Timestamp:   1000,
+				DataMessage: &receiver.DataMessage{},
+			},
+		}
+
+		_, ok := m.ExpiresAt()
+		assert.False(t, ok)
+		assert.False(t, m.IsExpired(time.Now()))
+	})
+
+	t.Run("disappearing message", func(t *testing.T) {
+		t.Parallel()
+
+		m := receiver.Message{
+			Envelope: receiver.Envelope{
+				Timestamp:   1000,
+				DataMessage: &receiver.DataMessage{ExpiresInSeconds: 60},
+			},
+		}
+
+		expiresAt, ok := m.ExpiresAt()
+		if assert.True(t, ok) {
+			assert.Equal(t, time.UnixMilli(61000), expiresAt)
+		}
+
+		assert.False(t, m.IsExpired(time.UnixMilli(60999)))
+		assert.True(t, m.IsExpired(time.UnixMilli(61000)))
+	})
+}
@@ -0,0 +1,194 @@
+package receiver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// The reasons a received message is not recorded, used as the reason label of
+// the ignored messages metric.
+const (
+	ignoredMessageType = "message-type"
+	ignoredExpired     = "expired"
+	ignoredDuplicate   = "duplicate"
+	ignoredQueueFull   = "queue-full"
+)
+
+// The reasons the websocket is considered dead, used as the reason label of the
+// keepalive timeouts metric.
+const (
+	keepalivePong    = "pong"
+	keepaliveSilence = "silence"
+)
+
+//nolint:gochecknoglobals
+var (
+	messagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_receiver_messages_received_total",
+		Help: "The messages received from the Signal API, by message type.",
+	}, []string{"type"})
+
+	messagesRecorded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_receiver_messages_recorded_total",
+		Help: "The messages recorded in the queue, by message type.",
+	}, []string{"type"})
+
+	messagesIgnored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_receiver_messages_ignored_total",
+		Help: "The messages received but not recorded, by message type and reason.",
+	}, []string{"type", "reason"})
+
+	decodeErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "signal_receiver_decode_errors_total",
+		Help: "The messages from the Signal API that could not be decoded.",
+	})
+
+	websocketConnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_receiver_websocket_connects_total",
+		Help: "The connections of the websocket to the Signal API, by account.",
+	}, []string{"account"})
+
+	websocketDisconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_receiver_websocket_disconnects_total",
+		Help: "The disconnections of the websocket to the Signal API, by account.",
+	}, []string{"account"})
+
+	reconnectAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_receiver_websocket_reconnect_attempts_total",
+		Help: "The attempts to reconnect the websocket to the Signal API, by account.",
+	}, []string{"account"})
+
+	keepaliveTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_receiver_websocket_keepalive_timeouts_total",
+		Help: "The websockets to the Signal API considered dead by the keepalive, by account and reason.",
+	}, []string{"account", "reason"})
+
+	handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "signal_receiver_notifier_handler_duration_seconds",
+		Help:    "The time taken by the notifier handlers to handle a payload.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler"})
+
+	handlerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signal_receiver_notifier_handler_errors_total",
+		Help: "The errors returned by the notifier handlers.",
+	}, []string{"handler"})
+)
+
+// messageTypeLabels returns the types of the message as metric labels. A
+// message has several types, so it is counted once for each.
+func messageTypeLabels(m Message) []string {
+	if len(m.MessageTypes()) == 0 {
+		return []string{"unknown"}
+	}
+
+	return m.MessageTypesStrings()
+}
+
+func countReceived(m Message) {
+	for _, mt := range messageTypeLabels(m) {
+		messagesReceived.WithLabelValues(mt).Inc()
+	}
+}
+
+func countRecorded(m Message) {
+	for _, mt := range messageTypeLabels(m) {
+		messagesRecorded.WithLabelValues(mt).Inc()
+	}
+}
+
+func countIgnored(m Message, reason string) {
+	for _, mt := range messageTypeLabels(m) {
+		messagesIgnored.WithLabelValues(mt, reason).Inc()
+	}
+}
+
+// observeHandler records the time taken by the handler and its error.
+func observeHandler(h handleable, start time.Time, err error) {
+	name := fmt.Sprintf("%T", h)
+
+	handlerDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		handlerErrors.WithLabelValues(name).Inc()
+	}
+}
+
+//nolint:gochecknoglobals
+var (
+	queueDepthDesc = prometheus.NewDesc(
+		"signal_receiver_queue_depth",
+		"The messages in the queue.",
+		[]string{"account"}, nil,
+	)
+
+	uptimeDesc = prometheus.NewDesc(
+		"signal_receiver_websocket_uptime_seconds",
+		"The time since the websocket to the Signal API connected, zero if it is disconnected.",
+		[]string{"account"}, nil,
+	)
+
+	evictedDesc = prometheus.NewDesc(
+		"signal_receiver_messages_evicted_total",
+		"The messages evicted from the queue, or not queued at all, because of the queue limits.",
+		[]string{"account"}, nil,
+	)
+
+	duplicatesDesc = prometheus.NewDesc(
+		"signal_receiver_messages_duplicates_total",
+		"The duplicate envelopes that were dropped.",
+		[]string{"account"}, nil,
+	)
+)
+
+// clientsCollector collects the metrics of the clients state when they are
+// scraped.
+type clientsCollector struct {
+	clients []*Client
+}
+
+func (cc clientsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- uptimeDesc
+	ch <- evictedDesc
+	ch <- duplicatesDesc
+}
+
+func (cc clientsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range cc.clients {
+		n, err := c.store.Len()
+		if err != nil {
+			c.logger.Error().Err(err).Msg("error counting the messages in the store")
+		}
+
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(n), c.account)
+		ch <- prometheus.MustNewConstMetric(uptimeDesc, prometheus.GaugeValue, c.Uptime().Seconds(), c.account)
+		ch <- prometheus.MustNewConstMetric(evictedDesc, prometheus.CounterValue, float64(c.Evicted()), c.account)
+		ch <- prometheus.MustNewConstMetric(duplicatesDesc, prometheus.CounterValue, float64(c.Duplicates()), c.account)
+	}
+}
+
+// RegisterMetrics registers the metrics of the clients state with the registry,
+// labelled by account: the queue depth, the uptime of the websocket connection
+// and the number of messages evicted and dropped as duplicates.
+func RegisterMetrics(r prometheus.Registerer, clients ...*Client) error {
+	if err := r.Register(clientsCollector{clients: clients}); err != nil {
+		return fmt.Errorf("error registering the metrics of the clients: %w", err)
+	}
+
+	return nil
+}
+
+// Uptime returns the time since the websocket connected, or zero if it is
+// disconnected.
+func (c *Client) Uptime() time.Duration {
+	connectedAt := c.connectedAt.Load()
+	if connectedAt == 0 {
+		return 0
+	}
+
+	return time.Since(time.Unix(0, connectedAt))
+}
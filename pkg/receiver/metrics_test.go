@@ -0,0 +1,105 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingHandler struct{}
+
+func (failingHandler) Handle(context.Context, NotifierPayload) error { return ErrNotifierClosed }
+
+// The metrics are shared by the tests running in parallel, so only the increase
+// of the counters is asserted.
+func TestRecordMessageMetrics(t *testing.T) {
+	t.Parallel()
+
+	c := newQueueClient(QueueLimits{MaxMessages: 1, OverflowPolicy: OverflowPolicyRefuse})
+
+	increase := func(counter prometheus.Counter, record func()) float64 {
+		before := testutil.ToFloat64(counter)
+
+		record()
+
+		return testutil.ToFloat64(counter) - before
+	}
+
+	assert.GreaterOrEqual(t, increase(decodeErrors, func() {
+		c.recordMessage(t.Context(), []byte("not json"))
+	}), 1.0)
+
+	assert.GreaterOrEqual(t, increase(messagesRecorded.WithLabelValues("data-message"), func() {
+		recordText(t, c, "0", 0)
+	}), 1.0)
+
+	assert.GreaterOrEqual(t, increase(messagesIgnored.WithLabelValues("data-message", ignoredQueueFull), func() {
+		recordText(t, c, "1", 0)
+	}), 1.0)
+
+	assert.GreaterOrEqual(t, increase(messagesIgnored.WithLabelValues("typing", ignoredMessageType), func() {
+		c.recordMessage(t.Context(), []byte(`{"envelope":{"typingMessage":{}}}`))
+	}), 1.0)
+
+	assert.GreaterOrEqual(t, increase(messagesReceived.WithLabelValues("unknown"), func() {
+		c.recordMessage(t.Context(), []byte(`{}`))
+	}), 1.0)
+
+	c.MessageNotifier.RegisterHandler(t.Context(), failingHandler{})
+
+	assert.GreaterOrEqual(t, increase(handlerErrors.WithLabelValues("receiver.failingHandler"), func() {
+		require.NoError(t, c.notifierTrigger(t.Context(), NotifierPayload{}))
+		require.NoError(t, c.MessageNotifier.Shutdown(t.Context()))
+	}), 1.0)
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	t.Parallel()
+
+	c := newQueueClient(QueueLimits{MaxMessages: 1, OverflowPolicy: OverflowPolicyDropOldest})
+
+	recordText(t, c, "0", 0)
+	recordText(t, c, "1", 0)
+
+	c.account = "+15550000001"
+
+	r := prometheus.NewPedanticRegistry()
+	require.NoError(t, RegisterMetrics(r, c))
+
+	write := func() string {
+		mfs, err := r.Gather()
+		require.NoError(t, err)
+
+		var sb strings.Builder
+
+		for _, mf := range mfs {
+			_, err := expfmt.MetricFamilyToText(&sb, mf)
+			require.NoError(t, err)
+		}
+
+		return sb.String()
+	}
+
+	out := write()
+	assert.Contains(t, out, `signal_receiver_queue_depth{account="+15550000001"} 1`+"\n")
+	assert.Contains(t, out, `signal_receiver_messages_evicted_total{account="+15550000001"} 1`+"\n")
+	assert.Contains(t, out, `signal_receiver_websocket_uptime_seconds{account="+15550000001"} 0`+"\n")
+
+	connects := websocketConnects.WithLabelValues("+15550000001")
+	before := testutil.ToFloat64(connects)
+
+	c.setConnected(t.Context(), true)
+	assert.Positive(t, c.Uptime())
+	assert.InDelta(t, before+1, testutil.ToFloat64(connects), 0)
+	assert.NotContains(t, write(), `signal_receiver_websocket_uptime_seconds{account="+15550000001"} 0`+"\n")
+
+	c.setConnected(t.Context(), false)
+	assert.Zero(t, c.Uptime())
+}
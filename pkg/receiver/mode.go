@@ -0,0 +1,64 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrModeUnknown is returned if the mode (string) is not known.
+var ErrModeUnknown = errors.New("mode is unknown")
+
+// Mode is how the messages are received from the Signal API, it depends on the
+// mode signal-cli-rest-api runs in, or on signal-cli daemon.
+type Mode uint8
+
+const (
+	// ModeWebsocket streams the messages from the websocket served by
+	// signal-cli-rest-api in json-rpc mode.
+	ModeWebsocket Mode = iota
+
+	// ModePoll polls the messages from the plain GET endpoint served by
+	// signal-cli-rest-api in normal or native mode.
+	ModePoll
+
+	// ModeDaemon streams the messages from the JSON-RPC receive notifications
+	// of signal-cli daemon, over --tcp or --socket, without signal-cli-rest-api.
+	ModeDaemon
+)
+
+// AllModes returns all valid modes.
+func AllModes() []Mode {
+	return []Mode{
+		ModeWebsocket,
+		ModePoll,
+		ModeDaemon,
+	}
+}
+
+// String returns the string representation of a mode.
+func (m Mode) String() string {
+	switch m {
+	case ModeWebsocket:
+		return "websocket"
+	case ModePoll:
+		return "poll"
+	case ModeDaemon:
+		return "daemon"
+	default:
+		panic(fmt.Sprintf("unknown mode %d", m))
+	}
+}
+
+// ParseMode parses a mode given its representation as a string.
+func ParseMode(m string) (Mode, error) {
+	switch m {
+	case "websocket":
+		return ModeWebsocket, nil
+	case "poll":
+		return ModePoll, nil
+	case "daemon":
+		return ModeDaemon, nil
+	default:
+		return ModeWebsocket, ErrModeUnknown
+	}
+}
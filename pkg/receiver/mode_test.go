@@ -0,0 +1,22 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMode(t *testing.T) {
+	t.Parallel()
+
+	for _, m := range AllModes() {
+		got, err := ParseMode(m.String())
+		require.NoError(t, err)
+		assert.Equal(t, m, got)
+	}
+
+	_, err := ParseMode("unknown")
+	require.ErrorIs(t, err, ErrModeUnknown)
+}
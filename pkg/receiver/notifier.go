@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -14,6 +15,22 @@ var ErrNotifierClosed = errors.New("notifier is closed")
 type NotifierPayload struct {
 	Message     *Message
 	IsConnected *bool
+
+	// Evicted is the number of messages evicted from the queue so far because
+	// of the queue limits.
+	Evicted uint64
+
+	// Deleted is a remote delete of a message by its author. The matching
+	// messages were removed from the queue.
+	Deleted *Message
+
+	// Edited is an edit of a message by its author. The text of the matching
+	// messages was replaced in the queue.
+	Edited *Message
+
+	// Reconnect is set before every attempt to reconnect to the Signal API
+	// after the websocket dropped.
+	Reconnect *ReconnectAttempt
 }
 
 type NotifierTrigger func(ctx context.Context, payload NotifierPayload) error
@@ -123,7 +140,12 @@ func (u *Notifier) trigger(ctx context.Context, payload NotifierPayload) error {
 		go func() {
 			defer u.wg.Done()
 
-			if err := handler.Handle(ctx, payload); err != nil {
+			start := time.Now()
+			err := handler.Handle(ctx, payload)
+
+			observeHandler(handler, start, err)
+
+			if err != nil {
 				zerolog.Ctx(ctx).Error().Err(err).Msg("error while handling new-message")
 			}
 		}()
@@ -0,0 +1,247 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrPollStatus is returned if the Signal API answers a poll with a status
+// other than 200 OK, e.g. when signal-cli-rest-api runs in json-rpc mode.
+var ErrPollStatus = errors.New("unexpected status polling the Signal API")
+
+const (
+	// DefaultPollInterval is the delay between two polls.
+	DefaultPollInterval = 5 * time.Second
+
+	// DefaultPollTimeout is how long signal-cli waits for messages during a
+	// poll.
+	DefaultPollTimeout = 10 * time.Second
+
+	// pollResponseMargin is added to the poll timeout to bound a poll, as
+	// signal-cli takes a while to start in normal mode.
+	pollResponseMargin = 30 * time.Second
+
+	// pollErrorBodySize bounds the part of an error response that is reported.
+	pollErrorBodySize = 512
+)
+
+// PollPolicy configures how the messages are polled in ModePoll. The zero value
+// of a field selects its default.
+type PollPolicy struct {
+	// Interval is the delay between the end of a poll and the next one.
+	Interval time.Duration
+
+	// Timeout is how long signal-cli waits for messages during a poll, it is
+	// rounded down to the second.
+	Timeout time.Duration
+}
+
+func (p PollPolicy) withDefaults() PollPolicy {
+	if p.Interval <= 0 {
+		p.Interval = DefaultPollInterval
+	}
+
+	if p.Timeout < time.Second {
+		p.Timeout = DefaultPollTimeout
+	}
+
+	return p
+}
+
+// poller polls the messages from the GET endpoint of the Signal API.
+type poller struct {
+	uri    *url.URL
+	client *http.Client
+
+	// localAddr is the local address of the last connection to the Signal API.
+	localAddr atomic.Pointer[net.TCPAddr]
+}
+
+// newPoller returns a poller of the websocket URI, configured as the dialer of
+// the websocket.
+func newPoller(uri *url.URL, dialer *websocket.Dialer, policy PollPolicy) *poller {
+	p := &poller{uri: pollURL(uri, policy.Timeout)}
+
+	netDialer := &net.Dialer{Timeout: handshakeTimeout}
+
+	p.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:               dialer.Proxy,
+			TLSClientConfig:     dialer.TLSClientConfig,
+			TLSHandshakeTimeout: dialer.HandshakeTimeout,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := netDialer.DialContext(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+
+				if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+					p.localAddr.Store(addr)
+				}
+
+				return conn, nil
+			},
+		},
+	}
+
+	return p
+}
+
+// pollURL returns the URL of the GET endpoint of the websocket URI, asking
+// signal-cli to wait for messages for the timeout.
+func pollURL(uri *url.URL, timeout time.Duration) *url.URL {
+	u := *uri
+
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+
+	query := u.Query()
+	query.Set("timeout", strconv.Itoa(int(timeout/time.Second)))
+	u.RawQuery = query.Encode()
+
+	return &u
+}
+
+// connectPoll polls the Signal API once, the client is connected if it
+// answered.
+func (c *Client) connectPoll(ctx context.Context) error {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+
+	c.logger.Info().Msg("Polling the Signal API")
+
+	return c.poll(ctx)
+}
+
+// pollLoop is the ReceiveLoop of ModePoll, it polls the Signal API every poll
+// interval until a poll fails or the client is closed.
+func (c *Client) pollLoop(ctx context.Context) error {
+	log := c.logger.With().Str("func", "ReceiveLoop").Logger()
+
+	c.connMu.Lock()
+	stopped := make(chan struct{})
+	c.stopped = stopped
+	c.connMu.Unlock()
+
+	defer close(stopped)
+
+	log.
+		Info().
+		Strs("recorded-message-types", c.recordedMessageTypesStrs).
+		Dur("interval", c.pollPolicy.Interval).
+		Msg("Starting the poll loop from Signal API")
+
+	timer := time.NewTimer(c.pollPolicy.Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-c.closing:
+			c.setConnected(ctx, false)
+
+			return ErrClientClosed
+		case <-ctx.Done():
+			c.setConnected(ctx, false)
+
+			return ctx.Err()
+		}
+
+		if err := c.poll(ctx); err != nil {
+			c.setConnected(ctx, false)
+
+			if c.isClosed() {
+				log.Info().Msg("the poll was interrupted by the client closing")
+
+				return ErrClientClosed
+			}
+
+			log.Error().Err(err).Msg("error polling the Signal API")
+
+			return err
+		}
+
+		timer.Reset(c.pollPolicy.Interval)
+	}
+}
+
+// poll records the messages returned by the Signal API.
+func (c *Client) poll(ctx context.Context) error {
+	frames, err := c.fetchPoll(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.setConnected(ctx, true)
+
+	for _, frame := range frames {
+		c.recordMessage(ctx, frame)
+	}
+
+	return nil
+}
+
+// fetchPoll returns the messages returned by the Signal API. The request is
+// cancelled if the client is closed.
+func (c *Client) fetchPoll(ctx context.Context) ([]json.RawMessage, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, c.pollPolicy.Timeout+pollResponseMargin)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-c.closing:
+			cancel()
+		case <-reqCtx.Done():
+		}
+	}()
+
+	header, err := c.dialOptions.header()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, c.poller.uri.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the poll request: %w", err)
+	}
+
+	req.Header = header
+
+	resp, err := c.poller.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error polling the Signal API: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		//nolint:errcheck // the body is only reported.
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, pollErrorBodySize))
+
+		return nil, fmt.Errorf("%w: %s: %s", ErrPollStatus, resp.Status, bytes.TrimSpace(body))
+	}
+
+	var frames []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&frames); err != nil {
+		return nil, fmt.Errorf("error decoding the polled messages: %w", err)
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,228 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPollClient returns a client polling the data messages from a Signal API
+// served by handle, which is called with the number of the poll starting at 1.
+func newPollClient(
+	t *testing.T,
+	opts Options,
+	handle func(n int32, w http.ResponseWriter, r *http.Request),
+) *Client {
+	t.Helper()
+
+	var polls atomic.Int32
+
+	trs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(polls.Add(1), w, r)
+	}))
+	t.Cleanup(trs.Close)
+
+	uri, err := url.Parse(trs.URL)
+	require.NoError(t, err)
+
+	// the websocket URL is polled over HTTP.
+	uri.Scheme = "ws"
+	uri = uri.JoinPath("/v1/receive/+15551234567")
+
+	opts.Mode = ModePoll
+	opts.MessageTypes = []string{MessageTypeDataMessage.String()}
+
+	client, err := New(newContext(), uri, opts)
+	require.NoError(t, err)
+
+	return client
+}
+
+// writeMessages answers a poll with a data message for every text.
+func writeMessages(t *testing.T, w http.ResponseWriter, texts ...string) {
+	t.Helper()
+
+	msgs := make([]Message, 0, len(texts))
+	for _, text := range texts {
+		msgs = append(msgs, Message{Envelope: Envelope{DataMessage: &DataMessage{Message: &text}}})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	assert.NoError(t, json.NewEncoder(w).Encode(msgs))
+}
+
+func TestPollURL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"ws://signal-api:8080/v1/receive/+1555", "http://signal-api:8080/v1/receive/+1555?timeout=10"},
+		{"wss://signal-api/v1/receive/+1555", "https://signal-api/v1/receive/+1555?timeout=10"},
+		{
+			"https://signal-api/v1/receive/+1555?ignore_stories=true",
+			"https://signal-api/v1/receive/+1555?ignore_stories=true&timeout=10",
+		},
+	}
+
+	for _, test := range tests {
+		uri, err := url.Parse(test.uri)
+		require.NoError(t, err)
+
+		assert.Equal(t, test.want, pollURL(uri, 10*time.Second+time.Millisecond).String())
+	}
+}
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+
+	t.Run("records the polled messages", func(t *testing.T) {
+		t.Parallel()
+
+		client := newPollClient(t, Options{
+			Poll: PollPolicy{Interval: time.Millisecond, Timeout: 2 * time.Second},
+			Dial: DialOptions{Header: http.Header{"Authorization": []string{"Bearer token"}}},
+		}, func(n int32, w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Equal(t, "/v1/receive/+15551234567", r.URL.Path)
+			assert.Equal(t, "2", r.URL.Query().Get("timeout"))
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+			switch n {
+			case 1:
+				writeMessages(t, w, "first", "second")
+			case 2:
+				writeMessages(t, w, "third")
+			default:
+				writeMessages(t, w)
+			}
+		})
+
+		assert.True(t, client.Connected())
+		assert.NotNil(t, client.LocalAddr())
+
+		ctx, cancel := context.WithCancel(t.Context())
+		runErr := make(chan error, 1)
+
+		go func() { runErr <- client.Run(ctx) }()
+
+		require.Eventually(t, func() bool {
+			count, _ := client.Count(DefaultConsumer)
+
+			return count == 3
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, []string{"first", "second", "third"}, messageTexts(client.Flush(DefaultConsumer, Filter{})))
+		assert.False(t, client.LastFrame().IsZero())
+
+		cancel()
+
+		require.ErrorIs(t, <-runErr, context.Canceled)
+		assert.False(t, client.Connected())
+	})
+
+	t.Run("publishes the polled frames", func(t *testing.T) {
+		t.Parallel()
+
+		client := newPollClient(t, Options{Poll: PollPolicy{Interval: time.Hour}},
+			func(n int32, w http.ResponseWriter, _ *http.Request) {
+				if n == 1 {
+					writeMessages(t, w)
+
+					return
+				}
+
+				writeMessages(t, w, "polled")
+			})
+
+		frames, stop := client.SubscribeFrames()
+		defer stop()
+
+		require.NoError(t, client.Connect(t.Context()))
+
+		select {
+		case f := <-frames:
+			assert.Contains(t, string(f.Data), "polled")
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "the frame was not published")
+		}
+	})
+
+	t.Run("gives up after the maximum attempts", func(t *testing.T) {
+		t.Parallel()
+
+		client := newPollClient(t, Options{
+			Poll:      PollPolicy{Interval: time.Millisecond},
+			Reconnect: ReconnectPolicy{InitialDelay: time.Millisecond, MaxAttempts: 3},
+		}, func(n int32, w http.ResponseWriter, _ *http.Request) {
+			// the API is switched to json-rpc mode after the first poll.
+			if n > 1 {
+				http.Error(w, "Only works in normal and native mode", http.StatusBadRequest)
+
+				return
+			}
+
+			writeMessages(t, w)
+		})
+
+		recorder := &reconnectRecorder{}
+		client.MessageNotifier.RegisterHandler(t.Context(), recorder)
+
+		err := client.Run(t.Context())
+		require.ErrorIs(t, err, ErrReconnectGaveUp)
+		require.ErrorIs(t, err, ErrPollStatus)
+		assert.Contains(t, err.Error(), "Only works in normal and native mode")
+		assert.False(t, client.Connected())
+
+		require.NoError(t, client.MessageNotifier.Shutdown(t.Context()))
+		assert.Equal(t, []int{1, 2, 3}, recorder.sorted())
+	})
+
+	t.Run("close interrupts the poll", func(t *testing.T) {
+		t.Parallel()
+
+		polling := make(chan struct{})
+
+		client := newPollClient(t, Options{Poll: PollPolicy{Interval: time.Millisecond}},
+			func(n int32, w http.ResponseWriter, r *http.Request) {
+				if n == 1 {
+					writeMessages(t, w)
+
+					return
+				}
+
+				// signal-cli waits for messages.
+				close(polling)
+				<-r.Context().Done()
+			})
+
+		loopErr := make(chan error, 1)
+
+		go func() { loopErr <- client.ReceiveLoop(t.Context()) }()
+
+		<-polling
+
+		require.NoError(t, client.Close(t.Context()))
+		require.ErrorIs(t, <-loopErr, ErrClientClosed)
+		require.ErrorIs(t, client.Connect(t.Context()), ErrClientClosed)
+	})
+
+	t.Run("fails if the Signal API does not answer the first poll", func(t *testing.T) {
+		t.Parallel()
+
+		uri := &url.URL{Scheme: "ws", Host: "127.0.0.1:1", Path: "/v1/receive/+15551234567"}
+
+		_, err := New(newContext(), uri, Options{Mode: ModePoll})
+		require.Error(t, err)
+	})
+}
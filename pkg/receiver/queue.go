@@ -0,0 +1,172 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrOverflowPolicyUnknown is returned if overflow policy (string) is not known.
+var ErrOverflowPolicyUnknown = errors.New("overflow policy is unknown")
+
+// OverflowPolicy defines what happens to a new message when the queue is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowPolicyDropOldest evicts the oldest message to make room for the new one.
+	OverflowPolicyDropOldest OverflowPolicy = iota
+
+	// OverflowPolicyDropNewest drops the new message.
+	OverflowPolicyDropNewest
+
+	// OverflowPolicyRefuse refuses the new message and logs it as an error.
+	OverflowPolicyRefuse
+)
+
+// AllOverflowPolicies returns all valid overflow policies.
+func AllOverflowPolicies() []OverflowPolicy {
+	return []OverflowPolicy{
+		OverflowPolicyDropOldest,
+		OverflowPolicyDropNewest,
+		OverflowPolicyRefuse,
+	}
+}
+
+// String returns the string representation of an overflow policy.
+func (op OverflowPolicy) String() string {
+	switch op {
+	case OverflowPolicyDropOldest:
+		return "drop-oldest"
+	case OverflowPolicyDropNewest:
+		return "drop-newest"
+	case OverflowPolicyRefuse:
+		return "refuse"
+	default:
+		panic(fmt.Sprintf("unknown overflow policy %d", op))
+	}
+}
+
+// ParseOverflowPolicy parses an overflow policy given its representation as a string.
+func ParseOverflowPolicy(op string) (OverflowPolicy, error) {
+	switch op {
+	case "drop-oldest":
+		return OverflowPolicyDropOldest, nil
+	case "drop-newest":
+		return OverflowPolicyDropNewest, nil
+	case "refuse":
+		return OverflowPolicyRefuse, nil
+	default:
+		return OverflowPolicyDropOldest, ErrOverflowPolicyUnknown
+	}
+}
+
+// QueueLimits bounds the queue of recorded messages. A zero value means no
+// limit.
+type QueueLimits struct {
+	// MaxMessages is the maximum number of messages in the queue.
+	MaxMessages int
+
+	// MaxAge is the maximum age of a message in the queue, based on the
+	// timestamp of its envelope. It does not apply to the messages that every
+	// consumer consumed, those are kept for the history retention of the store.
+	MaxAge time.Duration
+
+	// OverflowPolicy is applied when a message is recorded while the queue
+	// already holds MaxMessages.
+	OverflowPolicy OverflowPolicy
+}
+
+// Evicted returns the number of messages that were evicted from the queue, or
+// not queued at all, because of the queue limits.
+func (c *Client) Evicted() uint64 { return c.evicted.Load() }
+
+// makeRoom applies the queue limits before a new message is appended, and
+// reports whether the new message should be appended.
+func (c *Client) makeRoom() bool {
+	c.pruneExpired()
+
+	if c.limits.MaxMessages <= 0 {
+		return true
+	}
+
+	count, err := c.store.Len()
+	if err != nil {
+		c.logger.Error().Err(err).Msg("error counting the messages in the store")
+
+		return true
+	}
+
+	if count < c.limits.MaxMessages {
+		return true
+	}
+
+	switch c.limits.OverflowPolicy {
+	case OverflowPolicyDropOldest:
+		evicted, err := c.store.Trim(count - c.limits.MaxMessages + 1)
+		if err != nil {
+			c.logger.Error().Err(err).Msg("error evicting the oldest messages from the store")
+		}
+
+		c.recordEviction(evicted, "the queue is full, the oldest messages were evicted")
+
+		return true
+	case OverflowPolicyDropNewest:
+		c.recordEviction(1, "the queue is full, the new message was dropped")
+	case OverflowPolicyRefuse:
+		c.evicted.Add(1)
+
+		c.logger.
+			Error().
+			Int("queue-max-messages", c.limits.MaxMessages).
+			Uint64("evicted-total", c.evicted.Load()).
+			Msg("the queue is full, refusing the new message")
+	}
+
+	return false
+}
+
+// pruneExpired removes the disappearing messages that have expired, and
+// evicts the messages that are older than the maximum age and that were not
+// consumed by every consumer yet. The consumed messages kept as history are
+// only removed by the history retention.
+func (c *Client) pruneExpired() {
+	now := time.Now()
+
+	n, err := c.store.Delete(func(m Message) bool { return m.IsExpired(now) })
+	if err != nil {
+		c.logger.Error().Err(err).Msg("error removing the disappearing messages from the store")
+	} else if n > 0 {
+		c.logger.Info().Int("expired", n).Msg("disappearing messages have expired")
+	}
+
+	if c.limits.MaxAge <= 0 {
+		return
+	}
+
+	deadline := now.Add(-c.limits.MaxAge).UnixMilli()
+
+	n, err = c.store.Evict(func(m Message) bool {
+		return m.Envelope.Timestamp > 0 && m.Envelope.Timestamp < deadline
+	})
+	if err != nil {
+		c.logger.Error().Err(err).Msg("error evicting the expired messages from the store")
+
+		return
+	}
+
+	c.recordEviction(n, "messages older than the maximum age were evicted")
+}
+
+func (c *Client) recordEviction(n int, msg string) {
+	if n <= 0 {
+		return
+	}
+
+	total := c.evicted.Add(uint64(n))
+
+	c.logger.
+		Warn().
+		Int("evicted", n).
+		Uint64("evicted-total", total).
+		Msg(msg)
+}
@@ -0,0 +1,178 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueLimits(t *testing.T) {
+	t.Parallel()
+
+	t.Run("drop-oldest evicts the oldest messages", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{MaxMessages: 2, OverflowPolicy: OverflowPolicyDropOldest})
+
+		for _, text := range []string{"0", "1", "2"} {
+			recordText(t, c, text, 0)
+		}
+
+		assert.Equal(t, []string{"1", "2"}, messageTexts(c.Flush(DefaultConsumer, Filter{})))
+		assert.Equal(t, uint64(1), c.Evicted())
+	})
+
+	t.Run("drop-newest drops the new message", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{MaxMessages: 2, OverflowPolicy: OverflowPolicyDropNewest})
+
+		for _, text := range []string{"0", "1", "2"} {
+			recordText(t, c, text, 0)
+		}
+
+		assert.Equal(t, []string{"0", "1"}, messageTexts(c.Flush(DefaultConsumer, Filter{})))
+		assert.Equal(t, uint64(1), c.Evicted())
+	})
+
+	t.Run("refuse refuses the new message", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{MaxMessages: 1, OverflowPolicy: OverflowPolicyRefuse})
+
+		for _, text := range []string{"0", "1", "2"} {
+			recordText(t, c, text, 0)
+		}
+
+		assert.Equal(t, []string{"0"}, messageTexts(c.Flush(DefaultConsumer, Filter{})))
+		assert.Equal(t, uint64(2), c.Evicted())
+	})
+
+	t.Run("messages older than the maximum age are evicted", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{MaxAge: time.Hour})
+
+		recordText(t, c, "old", time.Now().Add(-2*time.Hour).UnixMilli())
+		recordText(t, c, "new", time.Now().UnixMilli())
+
+		assert.Equal(t, []string{"new"}, messageTexts(c.Flush(DefaultConsumer, Filter{})))
+		assert.Equal(t, uint64(1), c.Evicted())
+		assert.Equal(t, uint64(1), c.notifierPayload(nil, true).Evicted)
+	})
+
+	t.Run("the maximum age leaves the consumed history alone", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{MaxAge: time.Hour})
+		c.store = NewMemoryStore(StoreOptions{HistoryRetention: 24 * time.Hour})
+		require.NoError(t, c.store.AddConsumer(DefaultConsumer))
+
+		old := time.Now().Add(-2 * time.Hour).UnixMilli()
+
+		require.NoError(t, c.store.Append(&Message{Envelope: Envelope{Timestamp: old}}))
+		_, err := c.store.Flush(DefaultConsumer, nil)
+		require.NoError(t, err)
+
+		c.pruneExpired()
+
+		msgs, err := c.store.Since(0, 0)
+		require.NoError(t, err)
+		assert.Len(t, msgs, 1)
+		assert.Zero(t, c.Evicted())
+	})
+}
+
+func TestDisappearingMessages(t *testing.T) {
+	t.Parallel()
+
+	c := newQueueClient(QueueLimits{})
+
+	var notified []string
+
+	c.notifierTrigger = func(_ context.Context, payload NotifierPayload) error {
+		if payload.Message != nil {
+			notified = append(notified, *payload.Message.Envelope.DataMessage.Message)
+		}
+
+		return nil
+	}
+
+	text := "expired"
+
+	expired, err := json.Marshal(Message{
+		Envelope: Envelope{
+			Timestamp:   time.Now().Add(-time.Minute).UnixMilli(),
+			DataMessage: &DataMessage{Message: &text, ExpiresInSeconds: 30},
+		},
+	})
+	require.NoError(t, err)
+
+	c.recordMessage(t.Context(), expired)
+	recordText(t, c, "kept", time.Now().UnixMilli())
+
+	// the expired message is neither queued nor handed to the notifier handlers.
+	assert.Equal(t, []string{"kept"}, notified)
+	assert.Equal(t, []string{"kept"}, messageTexts(c.Flush(DefaultConsumer, Filter{})))
+	assert.Zero(t, c.Evicted())
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, op := range AllOverflowPolicies() {
+		got, err := ParseOverflowPolicy(op.String())
+		require.NoError(t, err)
+		assert.Equal(t, op, got)
+	}
+
+	_, err := ParseOverflowPolicy("unknown")
+	require.ErrorIs(t, err, ErrOverflowPolicyUnknown)
+}
+
+func newQueueClient(limits QueueLimits) *Client {
+	notifier, trigger := InitNotifier(newContext())
+
+	store := NewMemoryStore(StoreOptions{})
+	if err := store.AddConsumer(DefaultConsumer); err != nil {
+		panic(err)
+	}
+
+	return &Client{
+		logger:               logger,
+		recordedMessageTypes: map[MessageType]bool{MessageTypeDataMessage: true},
+		store:                store,
+		limits:               limits,
+		MessageNotifier:      notifier,
+		notifierTrigger:      trigger,
+	}
+}
+
+func recordText(t *testing.T, c *Client, text string, timestamp int64) {
+	t.Helper()
+
+	msg, err := json.Marshal(Message{
+		Envelope: Envelope{
+			Timestamp:   timestamp,
+			DataMessage: &DataMessage{Message: &text},
+		},
+	})
+	require.NoError(t, err)
+
+	c.recordMessage(t.Context(), msg)
+}
+
+func messageTexts(msgs []Message) []string {
+	texts := make([]string, 0, len(msgs))
+
+	for _, m := range msgs {
+		texts = append(texts, *m.Envelope.DataMessage.Message)
+	}
+
+	return texts
+}
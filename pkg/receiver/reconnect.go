@@ -0,0 +1,171 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrReconnectGaveUp is returned by Run once the reconnect policy's maximum
+// attempts failed in a row.
+var ErrReconnectGaveUp = errors.New("gave up reconnecting to the Signal API")
+
+const (
+	// DefaultReconnectInitialDelay is the delay before the first attempt to
+	// reconnect.
+	DefaultReconnectInitialDelay = time.Second
+
+	// DefaultReconnectMaxDelay bounds the delay between two attempts, before it
+	// is jittered.
+	DefaultReconnectMaxDelay = time.Minute
+
+	defaultReconnectMultiplier = 2
+	defaultReconnectJitter     = 0.2
+)
+
+// ReconnectPolicy configures how the client reconnects to the Signal API after
+// the websocket dropped. The zero value of a field selects its default.
+type ReconnectPolicy struct {
+	// InitialDelay is the delay before the first attempt, it is multiplied by
+	// Multiplier after every failed attempt up to MaxDelay.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+
+	// Jitter randomizes every delay, once it is capped to MaxDelay, by up to
+	// this fraction of it, e.g. 0.2 waits between 80% and 120% of the delay, so
+	// the clients of a restarted API do not all reconnect at once. Zero turns
+	// the jitter off, nil selects the default of 0.2.
+	Jitter *float64
+
+	// MaxAttempts is the number of attempts that may fail in a row before Run
+	// gives up, zero to never give up.
+	MaxAttempts int
+}
+
+// ReconnectAttempt describes an attempt to reconnect to the Signal API, it is
+// sent to the notifier handlers before the client waits for the delay.
+type ReconnectAttempt struct {
+	// Attempt counts the attempts since the websocket dropped, from 1.
+	Attempt int
+
+	// Delay is how long the client waits before the attempt.
+	Delay time.Duration
+
+	// Err is why the previous attempt failed, or why the websocket dropped
+	// before the first attempt.
+	Err error
+}
+
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = DefaultReconnectInitialDelay
+	}
+
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultReconnectMaxDelay
+	}
+
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultReconnectMultiplier
+	}
+
+	if p.Jitter == nil || *p.Jitter < 0 || *p.Jitter > 1 {
+		jitter := defaultReconnectJitter
+		p.Jitter = &jitter
+	}
+
+	return p
+}
+
+// delay returns the delay before the attempt, capped to the maximum delay then
+// jittered by r which is in the range [0, 1). The jitter is applied after the
+// cap so the attempts keep spreading out once the delay reached its maximum.
+func (p ReconnectPolicy) delay(attempt int, r float64) time.Duration {
+	d := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	d = min(d, float64(p.MaxDelay))
+	d *= 1 + *p.Jitter*(2*r-1)
+
+	return time.Duration(d)
+}
+
+// Run receives the messages from the Signal API, and reconnects with the
+// reconnect policy whenever the websocket drops. It returns once the client is
+// closed, ctx is done or the policy gives up. The websocket is closed when ctx
+// is done.
+func (c *Client) Run(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), closeTimeout)
+		defer cancel()
+
+		if err := c.Close(closeCtx); err != nil {
+			c.logger.Error().Err(err).Msg("error closing the websocket to the Signal API")
+		}
+	})
+	defer stop()
+
+	for {
+		err := c.ReceiveLoop(ctx)
+		if errors.Is(err, ErrClientClosed) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		if err := c.reconnect(ctx, err); err != nil {
+			return err
+		}
+	}
+}
+
+// reconnect connects again to the Signal API, waiting between the attempts.
+func (c *Client) reconnect(ctx context.Context, cause error) error {
+	for attempt := 1; ; attempt++ {
+		//nolint:gosec // the jitter needs no cryptographic randomness.
+		delay := c.reconnectPolicy.delay(attempt, rand.Float64())
+
+		c.logger.
+			Warn().
+			Err(cause).
+			Int("attempt", attempt).
+			Dur("delay", delay).
+			Msg("reconnecting to the Signal API")
+
+		reconnectAttempts.WithLabelValues(c.account).Inc()
+
+		payload := c.notifierPayload(nil, false)
+		payload.Reconnect = &ReconnectAttempt{Attempt: attempt, Delay: delay, Err: cause}
+
+		if err := c.notifierTrigger(ctx, payload); err != nil {
+			c.logger.Error().Err(err).Msg("error while handling notify trigger")
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-c.closing:
+			timer.Stop()
+
+			return ErrClientClosed
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		}
+
+		cause = c.Connect(ctx)
+		if cause == nil || errors.Is(cause, ErrClientClosed) {
+			return cause
+		}
+
+		if c.reconnectPolicy.MaxAttempts > 0 && attempt >= c.reconnectPolicy.MaxAttempts {
+			return fmt.Errorf("%w after %d attempts: %w", ErrReconnectGaveUp, attempt, cause)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	p := ReconnectPolicy{MaxDelay: 5 * time.Second}.withDefaults()
+
+	assert.Equal(t, DefaultReconnectInitialDelay, p.InitialDelay)
+	assert.InDelta(t, defaultReconnectMultiplier, p.Multiplier, 0)
+	require.NotNil(t, p.Jitter)
+	assert.InDelta(t, defaultReconnectJitter, *p.Jitter, 0)
+
+	tests := []struct {
+		attempt int
+		r       float64
+		want    time.Duration
+	}{
+		{1, 0.5, time.Second},
+		{2, 0.5, 2 * time.Second},
+		{3, 0.5, 4 * time.Second},
+		{4, 0.5, 5 * time.Second},
+		{20, 0.5, 5 * time.Second},
+		{1, 0, 800 * time.Millisecond},
+		{2, 1, 2400 * time.Millisecond},
+		{3, 1, 4800 * time.Millisecond},
+		// the delay is capped before it is jittered.
+		{4, 1, 6 * time.Second},
+		{20, 0, 4 * time.Second},
+		{20, 1, 6 * time.Second},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, p.delay(test.attempt, test.r), "attempt %d with %v", test.attempt, test.r)
+	}
+
+	t.Run("a jitter of zero turns it off", func(t *testing.T) {
+		t.Parallel()
+
+		var jitter float64
+
+		p := ReconnectPolicy{MaxDelay: 5 * time.Second, Jitter: &jitter}.withDefaults()
+
+		assert.Equal(t, time.Second, p.delay(1, 0))
+		assert.Equal(t, time.Second, p.delay(1, 0.99))
+		assert.Equal(t, 5*time.Second, p.delay(20, 0.99))
+	})
+}
+
+// reconnectRecorder is a notifier handler that records the reconnect attempts.
+type reconnectRecorder struct {
+	mu       sync.Mutex
+	attempts []int
+}
+
+func (r *reconnectRecorder) Handle(_ context.Context, payload NotifierPayload) error {
+	if payload.Reconnect == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts = append(r.attempts, payload.Reconnect.Attempt)
+
+	return nil
+}
+
+func (r *reconnectRecorder) sorted() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the handlers run concurrently.
+	sort.Ints(r.attempts)
+
+	return r.attempts
+}
+
+// newWebsocketClient returns a client recording the data messages from a Signal
+// API served by handle, which is called with the number of the connection
+// starting at 1.
+func newWebsocketClient(
+	t *testing.T,
+	opts Options,
+	handle func(n int32, w http.ResponseWriter, r *http.Request),
+) *Client {
+	t.Helper()
+
+	var connections atomic.Int32
+
+	trs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(connections.Add(1), w, r)
+	}))
+	t.Cleanup(trs.Close)
+
+	uri, err := url.Parse(trs.URL)
+	require.NoError(t, err)
+
+	uri.Scheme = "ws"
+
+	opts.MessageTypes = []string{MessageTypeDataMessage.String()}
+
+	client, err := New(newContext(), uri, opts)
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reconnects when the websocket drops", func(t *testing.T) {
+		t.Parallel()
+
+		client := newWebsocketClient(t, Options{Reconnect: ReconnectPolicy{InitialDelay: time.Millisecond}},
+			func(n int32, w http.ResponseWriter, r *http.Request) {
+				upgrader := websocket.Upgrader{}
+
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				text := "message"
+				assert.NoError(t, conn.WriteJSON(Message{Envelope: Envelope{DataMessage: &DataMessage{Message: &text}}}))
+
+				// the first connection drops right away, the next ones stay up.
+				if n > 1 {
+					conn.ReadMessage() //nolint:errcheck
+				}
+			})
+
+		recorder := &reconnectRecorder{}
+		client.MessageNotifier.RegisterHandler(t.Context(), recorder)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		runErr := make(chan error, 1)
+
+		go func() { runErr <- client.Run(ctx) }()
+
+		require.Eventually(t, func() bool {
+			count, _ := client.Count(DefaultConsumer)
+
+			return count == 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.True(t, client.Connected())
+
+		cancel()
+
+		require.ErrorIs(t, <-runErr, context.Canceled)
+		assert.False(t, client.Connected())
+
+		require.NoError(t, client.MessageNotifier.Shutdown(t.Context()))
+		assert.Equal(t, []int{1}, recorder.sorted())
+	})
+
+	t.Run("gives up after the maximum attempts", func(t *testing.T) {
+		t.Parallel()
+
+		opts := Options{Reconnect: ReconnectPolicy{InitialDelay: time.Millisecond, MaxAttempts: 3}}
+
+		client := newWebsocketClient(t, opts,
+			func(n int32, w http.ResponseWriter, r *http.Request) {
+				// the API goes away after the first connection.
+				if n > 1 {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+
+					return
+				}
+
+				upgrader := websocket.Upgrader{}
+
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+
+				conn.Close()
+			})
+
+		recorder := &reconnectRecorder{}
+		client.MessageNotifier.RegisterHandler(t.Context(), recorder)
+
+		err := client.Run(t.Context())
+		require.ErrorIs(t, err, ErrReconnectGaveUp)
+		require.ErrorIs(t, err, websocket.ErrBadHandshake)
+
+		require.NoError(t, client.MessageNotifier.Shutdown(t.Context()))
+		assert.Equal(t, []int{1, 2, 3}, recorder.sorted())
+	})
+
+	t.Run("stops waiting to reconnect once closed", func(t *testing.T) {
+		t.Parallel()
+
+		client := newWebsocketClient(t, Options{Reconnect: ReconnectPolicy{InitialDelay: time.Hour}},
+			func(_ int32, w http.ResponseWriter, r *http.Request) {
+				upgrader := websocket.Upgrader{}
+
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+
+				conn.Close()
+			})
+
+		runErr := make(chan error, 1)
+
+		go func() { runErr <- client.Run(t.Context()) }()
+
+		require.Eventually(t, func() bool { return !client.Connected() }, 5*time.Second, 10*time.Millisecond)
+		require.NoError(t, client.Close(t.Context()))
+
+		select {
+		case err := <-runErr:
+			require.ErrorIs(t, err, ErrClientClosed)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected Run to return once the client is closed")
+		}
+	})
+}
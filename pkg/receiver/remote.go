@@ -0,0 +1,63 @@
+package receiver
+
+import "context"
+
+// isRemoteDelete reports whether the message deletes a message of its author.
+func isRemoteDelete(m Message) bool {
+	return m.Envelope.DataMessage != nil && m.Envelope.DataMessage.RemoteDelete != nil
+}
+
+// isEdit reports whether the message edits a message of its author.
+func isEdit(m Message) bool {
+	return m.Envelope.EditMessage != nil && m.Envelope.EditMessage.DataMessage != nil
+}
+
+// isRemoteChange reports whether the message is a remote delete or an edit,
+// these are never queued themselves.
+func isRemoteChange(m Message) bool { return isRemoteDelete(m) || isEdit(m) }
+
+// applyRemoteChange applies a remote delete or an edit to the queued messages
+// it refers to, and hands it to the notifier handlers.
+func (c *Client) applyRemoteChange(ctx context.Context, m Message) {
+	author := m.Author()
+	payload := c.notifierPayload(nil, c.connected.Load())
+
+	switch {
+	case isRemoteDelete(m):
+		target := m.Envelope.DataMessage.RemoteDelete.Timestamp
+
+		n, err := c.store.Delete(func(q Message) bool { return q.IsSentAt(author, target) })
+		if err != nil {
+			c.logger.Error().Err(err).Msg("error removing a remotely deleted message from the store")
+		}
+
+		c.logger.Info().Int("removed", n).Int64("target-timestamp", target).Msg("a message was deleted by its author")
+
+		payload.Deleted = &m
+	case isEdit(m):
+		target := m.Envelope.EditMessage.TargetSentTimestamp
+		text := m.Envelope.EditMessage.DataMessage.Message
+
+		n, err := c.store.Update(
+			func(q Message) bool { return q.IsSentAt(author, target) && q.Envelope.DataMessage != nil },
+			func(q *Message) {
+				dm := *q.Envelope.DataMessage
+				dm.Message = text
+				q.Envelope.DataMessage = &dm
+			},
+		)
+		if err != nil {
+			c.logger.Error().Err(err).Msg("error editing a message in the store")
+		}
+
+		c.logger.Info().Int("edited", n).Int64("target-timestamp", target).Msg("a message was edited by its author")
+
+		payload.Edited = &m
+	default:
+		return
+	}
+
+	if err := c.notifierTrigger(ctx, payload); err != nil {
+		c.logger.Error().Err(err).Msg("error while handling a remote change")
+	}
+}
@@ -0,0 +1,134 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteChanges(t *testing.T) {
+	t.Parallel()
+
+	t.Run("a remote delete removes the message of its author", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{})
+
+		var deleted []*Message
+
+		c.notifierTrigger = func(_ context.Context, payload NotifierPayload) error {
+			if payload.Deleted != nil {
+				deleted = append(deleted, payload.Deleted)
+			}
+
+			return nil
+		}
+
+		recordEnvelope(t, c, "alice", Envelope{SourceUUID: "alice", Timestamp: 1})
+		recordEnvelope(t, c, "bob", Envelope{SourceUUID: "bob", Timestamp: 1})
+		recordEnvelope(t, c, "alice again", Envelope{SourceUUID: "alice", Timestamp: 2})
+
+		recordRaw(t, c, Message{Envelope: Envelope{
+			SourceUUID: "alice",
+			Timestamp:  3,
+			DataMessage: &DataMessage{RemoteDelete: &struct {
+				Timestamp int64 `json:"timestamp"`
+			}{Timestamp: 1}},
+		}})
+
+		assert.Equal(t, []string{"bob", "alice again"}, messageTexts(c.Flush(DefaultConsumer, Filter{})))
+
+		require.Len(t, deleted, 1)
+		assert.Equal(t, "alice", deleted[0].Author())
+	})
+
+	t.Run("an edit replaces the text of the message of its author", func(t *testing.T) {
+		t.Parallel()
+
+		c := newQueueClient(QueueLimits{})
+
+		var edited []*Message
+
+		c.notifierTrigger = func(_ context.Context, payload NotifierPayload) error {
+			if payload.Edited != nil {
+				edited = append(edited, payload.Edited)
+			}
+
+			return nil
+		}
+
+		recordEnvelope(t, c, "helo", Envelope{SourceUUID: "alice", Timestamp: 1})
+		recordEnvelope(t, c, "bob", Envelope{SourceUUID: "bob", Timestamp: 1})
+
+		text := "hello"
+
+		recordRaw(t, c, Message{Envelope: Envelope{
+			SourceUUID: "alice",
+			Timestamp:  2,
+			EditMessage: &EditMessage{
+				TargetSentTimestamp: 1,
+				DataMessage:         &DataMessage{Message: &text},
+			},
+		}})
+
+		msgs := c.Flush(DefaultConsumer, Filter{})
+		assert.Equal(t, []string{"hello", "bob"}, messageTexts(msgs))
+		assert.Equal(t, uint64(1), msgs[0].ID)
+		assert.Len(t, edited, 1)
+	})
+}
+
+func TestRemoteChangesAreDeduplicated(t *testing.T) {
+	t.Parallel()
+
+	c := newQueueClient(QueueLimits{})
+	c.dedup = newDedupIndex(time.Minute)
+
+	var (
+		deleted   int
+		connected []bool
+	)
+
+	c.notifierTrigger = func(_ context.Context, payload NotifierPayload) error {
+		if payload.Deleted != nil {
+			deleted++
+			connected = append(connected, *payload.IsConnected)
+		}
+
+		return nil
+	}
+
+	recordEnvelope(t, c, "alice", Envelope{SourceUUID: "alice", Timestamp: 1})
+
+	remoteDelete := Message{Envelope: Envelope{
+		SourceUUID: "alice",
+		Timestamp:  3,
+		DataMessage: &DataMessage{RemoteDelete: &struct {
+			Timestamp int64 `json:"timestamp"`
+		}{Timestamp: 1}},
+	}}
+
+	recordRaw(t, c, remoteDelete)
+	recordRaw(t, c, remoteDelete)
+
+	assert.Empty(t, c.Flush(DefaultConsumer, Filter{}))
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, uint64(1), c.Duplicates())
+
+	// the payload carries the state of the connection, it is not connected.
+	assert.Equal(t, []bool{false}, connected)
+}
+
+func recordRaw(t *testing.T, c *Client, m Message) {
+	t.Helper()
+
+	msg, err := json.Marshal(m)
+	require.NoError(t, err)
+
+	c.recordMessage(t.Context(), msg)
+}
@@ -0,0 +1,140 @@
+package receiver
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// DefaultConsumer is the consumer used by the routes that are not scoped to a
+// consumer.
+const DefaultConsumer = "default"
+
+var (
+	// ErrInvalidConsumer is returned if a consumer name is not valid.
+	ErrInvalidConsumer = errors.New("invalid consumer name")
+
+	// ErrConsumerNotFound is returned if a consumer does not exist.
+	ErrConsumerNotFound = errors.New("consumer not found")
+
+	// ErrLeaseNotFound is returned if a receipt handle does not match a lease,
+	// or if the lease has expired.
+	ErrLeaseNotFound = errors.New("lease not found")
+
+	consumerRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+)
+
+// ValidateConsumer returns an error if the consumer name is not valid. A valid
+// name starts with a letter or a digit, followed by up to 63 letters, digits,
+// dots, dashes or underscores.
+func ValidateConsumer(name string) error {
+	if !consumerRegex.MatchString(name) {
+		return ErrInvalidConsumer
+	}
+
+	return nil
+}
+
+// StoreOptions configures a MessageStore.
+type StoreOptions struct {
+	// HistoryRetention is how long the messages that every consumer has
+	// consumed are kept, so they can still be read with Since. They are removed
+	// right away if it is not positive. It is independent of QueueLimits.MaxAge.
+	HistoryRetention time.Duration
+
+	// FirstID is the ID of the first message appended to a store that never
+	// held any, the IDs start at 1 if it is zero. A MemoryStore forgets its IDs
+	// when the process exits, seeding it from the clock keeps the IDs increasing
+	// across restarts so the cursors of the clients remain valid.
+	FirstID uint64
+}
+
+// MessageStore holds the recorded messages in a log that is shared by all the
+// consumers. Each consumer keeps its own cursor over the log so every consumer
+// sees every message exactly once, and a message is removed from the log once
+// all the consumers have consumed it. Consumers must be added before they
+// consume messages, the methods scoped to a consumer return ErrConsumerNotFound
+// for a consumer that does not exist. Messages are kept for a consumer until it
+// is removed.
+// All methods must be safe for concurrent use.
+type MessageStore interface {
+	// Append adds the message to the tail of the log and sets its ID.
+	Append(msg *Message) error
+
+	// Pop consumes and returns the oldest message pending for the consumer for
+	// which match returns true, or nil if there is none. Leased messages are
+	// skipped. A nil match matches every message.
+	Pop(consumer string, match func(Message) bool) (*Message, error)
+
+	// Flush consumes and returns all the messages pending for the consumer for
+	// which match returns true, the others stay pending in order. Leased
+	// messages are skipped. A nil match matches every message.
+	Flush(consumer string, match func(Message) bool) ([]Message, error)
+
+	// Lease hides the oldest message pending for the consumer for the visibility
+	// timeout and returns it along with a receipt handle, or nil if there is
+	// none. The message is consumed when the handle is acked, and becomes
+	// visible again if it is not acked before the timeout. Leases are not
+	// persisted, leased messages are visible again after a restart.
+	Lease(consumer string, timeout time.Duration) (*Message, string, error)
+
+	// Ack consumes the message leased with the receipt handle.
+	Ack(handle string) error
+
+	// Peek returns up to limit of the oldest messages pending for the consumer
+	// without consuming them. All messages are returned if limit is not
+	// positive.
+	Peek(consumer string, limit int) ([]Message, error)
+
+	// Count returns the number of messages pending for the consumer.
+	Count(consumer string) (int, error)
+
+	// Since returns up to limit of the messages recorded after the message with
+	// the cursor ID, without consuming them. It includes the messages that were
+	// consumed but are still within the history retention, and leaves out the
+	// view-once messages. All messages are returned if limit is not positive.
+	Since(cursor uint64, limit int) ([]Message, error)
+
+	// LastID returns the ID of the last message appended to the log, whether it
+	// is still in the log or not, or FirstID - 1 if none was appended yet.
+	LastID() (uint64, error)
+
+	// Len returns the number of messages in the log that were not consumed by
+	// every consumer yet.
+	Len() (int, error)
+
+	// Delete removes all the messages for which match returns true from the log
+	// and returns how many were removed.
+	Delete(match func(Message) bool) (int, error)
+
+	// Update applies update to all the messages for which match returns true
+	// and returns how many were updated. The ID of a message never changes.
+	// update is given a shallow copy of the message, the values it points to
+	// must be replaced rather than modified.
+	Update(match func(Message) bool, update func(*Message)) (int, error)
+
+	// Trim removes up to n of the oldest messages that were not consumed by
+	// every consumer yet, whether some consumers consumed them or not, and
+	// returns how many were removed.
+	Trim(n int) (int, error)
+
+	// Evict removes all the messages that were not consumed by every consumer
+	// yet for which match returns true, and returns how many were removed. The
+	// messages that are only kept as history are left alone.
+	Evict(match func(Message) bool) (int, error)
+
+	// AddConsumer declares a consumer so messages are kept for it even before it
+	// consumed its first message.
+	AddConsumer(name string) error
+
+	// Consumers returns the names of the consumers, sorted.
+	Consumers() ([]string, error)
+
+	// RemoveConsumer removes the consumer along with its cursor and its leases,
+	// so messages are no longer kept for it. ErrConsumerNotFound is returned if
+	// the consumer does not exist.
+	RemoveConsumer(name string) error
+
+	// Close releases the resources held by the store.
+	Close() error
+}
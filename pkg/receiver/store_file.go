@@ -0,0 +1,229 @@
+package receiver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	journalFileName = "messages.journal"
+
+	// journalCompactThreshold is the minimum number of journal entries written
+	// before the journal is considered for compaction.
+	journalCompactThreshold = 1024
+)
+
+var (
+	// ErrJournalCorrupted is returned if the journal contains an entry that
+	// cannot be decoded and that is not the last entry of the journal.
+	ErrJournalCorrupted = errors.New("message journal is corrupted")
+
+	// ErrJournalExists is returned by MoveFileStore if the destination already
+	// holds a journal.
+	ErrJournalExists = errors.New("message journal already exists")
+)
+
+// FileStore is a MessageStore backed by an append-only journal inside a data
+// directory. Every mutation is written and synced to the journal before it is
+// applied in memory, so the log and the cursors of the consumers are restored
+// exactly as they were after a restart or a crash.
+type FileStore struct {
+	logStore
+
+	path    string
+	file    *os.File
+	written int
+}
+
+// NewFileStore opens (or creates) the journal inside dataDir, replays it and
+// returns the resulting store.
+func NewFileStore(dataDir string, opts StoreOptions) (*FileStore, error) {
+	if err := os.MkdirAll(dataDir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating the data directory %q: %w", dataDir, err)
+	}
+
+	fs := &FileStore{path: filepath.Join(dataDir, journalFileName)}
+	fs.init(opts)
+	fs.persist = fs.write
+
+	if err := fs.replay(); err != nil {
+		return nil, err
+	}
+
+	// compact on open so the journal does not grow across restarts.
+	if err := fs.compact(); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// MoveFileStore moves the journal of the FileStore in the from directory to the
+// to directory, so the store is opened from there instead. It returns false if
+// from holds no journal, and ErrJournalExists if to already holds one, rather
+// than choose which of them to keep.
+func MoveFileStore(from, to string) (bool, error) {
+	src := filepath.Join(from, journalFileName)
+	dst := filepath.Join(to, journalFileName)
+
+	if _, err := os.Stat(src); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("error reading the journal %q: %w", src, err)
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		return false, fmt.Errorf("%w: %q and %q", ErrJournalExists, src, dst)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("error reading the journal %q: %w", dst, err)
+	}
+
+	if err := os.MkdirAll(to, 0o750); err != nil {
+		return false, fmt.Errorf("error creating the data directory %q: %w", to, err)
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		return false, fmt.Errorf("error moving the journal %q to %q: %w", src, dst, err)
+	}
+
+	return true, nil
+}
+
+// Close implements MessageStore.
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.file == nil {
+		return nil
+	}
+
+	err := fs.file.Close()
+	fs.file = nil
+
+	return err
+}
+
+// write writes the entry to the journal, it is applied in memory once it is
+// safely on disk.
+func (fs *FileStore) write(entry journalEntry) error {
+	if fs.file == nil {
+		return os.ErrClosed
+	}
+
+	if fs.written > journalCompactThreshold && fs.written > 2*len(fs.log.entries) {
+		// the journal is still valid if compaction fails, it is retried on the
+		// next write.
+		_ = fs.compact()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding the journal entry: %w", err)
+	}
+
+	if _, err := fs.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing to the journal: %w", err)
+	}
+
+	if err := fs.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing the journal: %w", err)
+	}
+
+	fs.written++
+
+	return nil
+}
+
+func (fs *FileStore) replay() error {
+	f, err := os.Open(fs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("error opening the journal %q: %w", fs.path, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a partial line without a newline is a write that was interrupted by
+			// a crash, it was never acknowledged so it is safe to drop.
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("error reading the journal %q: %w", fs.path, err)
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("%w: %w", ErrJournalCorrupted, err)
+		}
+
+		fs.log.apply(entry)
+	}
+}
+
+// compact rewrites the journal so it only contains the current state of the
+// log. The new journal is written to a temporary file and renamed over
+// the old one so a crash never leaves a partially written journal behind. The
+// temporary file is opened in append mode and becomes the journal once it is
+// renamed, so the store never writes to a journal that was replaced.
+func (fs *FileStore) compact() error {
+	tmpPath := fs.path + ".tmp"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creating the compacted journal: %w", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+
+	for _, entry := range fs.log.snapshot() {
+		if err := enc.Encode(entry); err != nil {
+			tmp.Close()
+
+			return fmt.Errorf("error writing the compacted journal: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("error writing the compacted journal: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("error syncing the compacted journal: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, fs.path); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("error replacing the journal: %w", err)
+	}
+
+	if fs.file != nil {
+		fs.file.Close()
+	}
+
+	fs.file = tmp
+	fs.written = len(fs.log.entries)
+
+	return nil
+}
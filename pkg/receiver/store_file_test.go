@@ -0,0 +1,293 @@
+package receiver_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/receiver"
+)
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pop and flush return messages in order", func(t *testing.T) {
+		t.Parallel()
+
+		fs, err := receiver.NewFileStore(t.TempDir(), receiver.StoreOptions{})
+		require.NoError(t, err)
+		require.NoError(t, fs.AddConsumer(receiver.DefaultConsumer))
+
+		defer fs.Close()
+
+		for _, a := range []string{"0", "1", "2"} {
+			require.NoError(t, fs.Append(&receiver.Message{Account: a}))
+		}
+
+		msg, err := fs.Pop(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+
+		if assert.NotNil(t, msg) {
+			assert.Equal(t, receiver.Message{ID: 1, Account: "0"}, *msg)
+		}
+
+		msgs, err := fs.Flush(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, []receiver.Message{{ID: 2, Account: "1"}, {ID: 3, Account: "2"}}, msgs)
+
+		msg, err = fs.Pop(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+		assert.Nil(t, msg)
+	})
+
+	t.Run("the queue survives a restart", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		fs, err := receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+		require.NoError(t, fs.AddConsumer(receiver.DefaultConsumer))
+
+		for _, a := range []string{"0", "1", "2"} {
+			require.NoError(t, fs.Append(&receiver.Message{Account: a}))
+		}
+
+		_, err = fs.Pop(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+
+		_, err = fs.Delete(func(m receiver.Message) bool { return m.Account == "1" })
+		require.NoError(t, err)
+
+		require.NoError(t, fs.Append(&receiver.Message{Account: "3"}))
+		require.NoError(t, fs.Close())
+
+		fs, err = receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+
+		defer fs.Close()
+
+		msgs, err := fs.Flush(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, []receiver.Message{{ID: 3, Account: "2"}, {ID: 4, Account: "3"}}, msgs)
+	})
+
+	t.Run("the cursors of the consumers survive a restart", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		fs, err := receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, fs.AddConsumer("ha"))
+		require.NoError(t, fs.AddConsumer("node-red"))
+
+		for _, a := range []string{"0", "1"} {
+			require.NoError(t, fs.Append(&receiver.Message{Account: a}))
+		}
+
+		_, err = fs.Pop("ha", nil)
+		require.NoError(t, err)
+		require.NoError(t, fs.Close())
+
+		fs, err = receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+
+		defer fs.Close()
+
+		msgs, err := fs.Flush("ha", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []receiver.Message{{ID: 2, Account: "1"}}, msgs)
+
+		msgs, err = fs.Flush("node-red", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []receiver.Message{{ID: 1, Account: "0"}, {ID: 2, Account: "1"}}, msgs)
+	})
+
+	t.Run("a removed consumer stays removed after a restart", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		fs, err := receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, fs.AddConsumer("ha"))
+		require.NoError(t, fs.AddConsumer("typo"))
+		require.NoError(t, fs.Append(&receiver.Message{Account: "0"}))
+
+		_, err = fs.Flush("ha", nil)
+		require.NoError(t, err)
+		require.NoError(t, fs.RemoveConsumer("typo"))
+		require.NoError(t, fs.Close())
+
+		fs, err = receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+
+		defer fs.Close()
+
+		require.ErrorIs(t, fs.RemoveConsumer("typo"), receiver.ErrConsumerNotFound)
+
+		n, err := fs.Len()
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("writes after a compaction survive a restart", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		fs, err := receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+		require.NoError(t, fs.AddConsumer(receiver.DefaultConsumer))
+
+		// every message is consumed right away, so the journal is compacted while
+		// the store is written to.
+		for i := range 600 {
+			require.NoError(t, fs.Append(&receiver.Message{Account: strconv.Itoa(i)}))
+
+			_, err = fs.Pop(receiver.DefaultConsumer, nil)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, fs.Append(&receiver.Message{Account: "last"}))
+		require.NoError(t, fs.Close())
+
+		fs, err = receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+
+		defer fs.Close()
+
+		msgs, err := fs.Flush(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []receiver.Message{{ID: 601, Account: "last"}}, msgs)
+	})
+
+	t.Run("the history survives a restart", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		opts := receiver.StoreOptions{HistoryRetention: time.Hour}
+
+		fs, err := receiver.NewFileStore(dir, opts)
+		require.NoError(t, err)
+
+		require.NoError(t, fs.AddConsumer(receiver.DefaultConsumer))
+		require.NoError(t, fs.Append(&receiver.Message{Account: "0"}))
+
+		_, err = fs.Flush(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+		require.NoError(t, fs.Close())
+
+		fs, err = receiver.NewFileStore(dir, opts)
+		require.NoError(t, err)
+
+		defer fs.Close()
+
+		// the consumed message is history, it is not delivered again.
+		require.NoError(t, fs.AddConsumer("ha"))
+
+		msgs, err := fs.Flush("ha", nil)
+		require.NoError(t, err)
+		assert.Empty(t, msgs)
+
+		msgs, err = fs.Since(0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []receiver.Message{{ID: 1, Account: "0"}}, msgs)
+	})
+
+	t.Run("an interrupted write is dropped on replay", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		fs, err := receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+		require.NoError(t, fs.AddConsumer(receiver.DefaultConsumer))
+
+		require.NoError(t, fs.Append(&receiver.Message{Account: "0"}))
+		require.NoError(t, fs.Close())
+
+		f, err := os.OpenFile(filepath.Join(dir, "messages.journal"), os.O_APPEND|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+
+		_, err = f.WriteString(`{"op":"append","message":{"acc`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		fs, err = receiver.NewFileStore(dir, receiver.StoreOptions{})
+		require.NoError(t, err)
+
+		defer fs.Close()
+
+		msgs, err := fs.Flush(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, []receiver.Message{{ID: 1, Account: "0"}}, msgs)
+	})
+}
+
+func TestMoveFileStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("the journal is moved along with its messages and cursors", func(t *testing.T) {
+		t.Parallel()
+
+		from := t.TempDir()
+		to := filepath.Join(from, "+15550000001")
+
+		fs, err := receiver.NewFileStore(from, receiver.StoreOptions{})
+		require.NoError(t, err)
+		require.NoError(t, fs.AddConsumer(receiver.DefaultConsumer))
+
+		for _, a := range []string{"0", "1"} {
+			require.NoError(t, fs.Append(&receiver.Message{Account: a}))
+		}
+
+		_, err = fs.Pop(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+		require.NoError(t, fs.Close())
+
+		moved, err := receiver.MoveFileStore(from, to)
+		require.NoError(t, err)
+		assert.True(t, moved)
+
+		fs, err = receiver.NewFileStore(to, receiver.StoreOptions{})
+		require.NoError(t, err)
+
+		defer fs.Close()
+
+		msgs, err := fs.Flush(receiver.DefaultConsumer, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []receiver.Message{{ID: 2, Account: "1"}}, msgs)
+
+		// there is nothing left to move.
+		moved, err = receiver.MoveFileStore(from, to)
+		require.NoError(t, err)
+		assert.False(t, moved)
+	})
+
+	t.Run("an existing journal is not overwritten", func(t *testing.T) {
+		t.Parallel()
+
+		from, to := t.TempDir(), t.TempDir()
+
+		for _, dir := range []string{from, to} {
+			fs, err := receiver.NewFileStore(dir, receiver.StoreOptions{})
+			require.NoError(t, err)
+			require.NoError(t, fs.Close())
+		}
+
+		_, err := receiver.MoveFileStore(from, to)
+		require.ErrorIs(t, err, receiver.ErrJournalExists)
+	})
+}
@@ -0,0 +1,729 @@
+package receiver
+
+import (
+	"crypto/rand"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+type journalOp string
+
+const (
+	journalOpSequence journalOp = "sequence"
+	journalOpAppend   journalOp = "append"
+	journalOpConsumer journalOp = "consumer"
+	journalOpConsume  journalOp = "consume"
+	journalOpDelete   journalOp = "delete"
+	journalOpUpdate   journalOp = "update"
+	journalOpRemove   journalOp = "remove-consumer"
+)
+
+// journalEntry describes a single mutation of a messageLog. It is what the
+// FileStore writes to its journal.
+type journalEntry struct {
+	Op       journalOp `json:"op"`
+	Seq      uint64    `json:"seq,omitempty"`
+	Seqs     []uint64  `json:"seqs,omitempty"`
+	Consumer string    `json:"consumer,omitempty"`
+	Message  *Message  `json:"message,omitempty"`
+	At       int64     `json:"at,omitempty"`
+	Released bool      `json:"released,omitempty"`
+}
+
+// logEntry is a message in the log. An entry is released once every consumer
+// has consumed it, it is then only kept as history.
+type logEntry struct {
+	seq      uint64
+	msg      Message
+	at       time.Time
+	released bool
+}
+
+// consumerState tracks what a consumer has consumed: every entry up to and
+// including cursor, plus the entries after it that are in done.
+type consumerState struct {
+	cursor uint64
+	done   map[uint64]bool
+}
+
+func (cs *consumerState) consumed(seq uint64) bool {
+	return seq <= cs.cursor || cs.done[seq]
+}
+
+// messageLog is the in-memory log shared by the MessageStore implementations.
+// It is only ever mutated by apply, which makes it possible to journal every
+// mutation and to replay the journal.
+type messageLog struct {
+	lastSeq   uint64
+	entries   []logEntry
+	consumers map[string]*consumerState
+
+	// retain keeps the released entries in the log instead of removing them.
+	retain bool
+}
+
+func newMessageLog(retain bool) messageLog {
+	return messageLog{consumers: make(map[string]*consumerState), retain: retain}
+}
+
+func (l *messageLog) apply(entry journalEntry) {
+	switch entry.Op {
+	case journalOpSequence:
+		l.lastSeq = max(l.lastSeq, entry.Seq)
+	case journalOpAppend:
+		if entry.Message == nil {
+			return
+		}
+
+		seq := entry.Seq
+		if seq == 0 {
+			seq = l.lastSeq + 1
+		}
+
+		msg := *entry.Message
+		msg.ID = seq
+
+		var at time.Time
+		if entry.At > 0 {
+			at = time.UnixMilli(entry.At)
+		}
+
+		l.lastSeq = max(l.lastSeq, seq)
+		l.entries = append(l.entries, logEntry{seq: seq, msg: msg, at: at, released: entry.Released})
+	case journalOpConsumer:
+		cs := &consumerState{cursor: entry.Seq, done: make(map[uint64]bool)}
+		for _, seq := range entry.Seqs {
+			cs.done[seq] = true
+		}
+
+		l.consumers[entry.Consumer] = cs
+		l.advance(cs)
+	case journalOpConsume:
+		cs, ok := l.consumers[entry.Consumer]
+		if !ok {
+			return
+		}
+
+		for _, seq := range entry.Seqs {
+			cs.done[seq] = true
+		}
+
+		l.advance(cs)
+		l.trim()
+	case journalOpDelete:
+		l.remove(func(e logEntry) bool { return slices.Contains(entry.Seqs, e.seq) })
+	case journalOpUpdate:
+		if entry.Message == nil {
+			return
+		}
+
+		for i := range l.entries {
+			if l.entries[i].seq == entry.Seq {
+				l.entries[i].msg = *entry.Message
+				l.entries[i].msg.ID = entry.Seq
+			}
+		}
+	case journalOpRemove:
+		delete(l.consumers, entry.Consumer)
+		l.trim()
+	}
+}
+
+// advance moves the cursor of the consumer past the entries it consumed.
+func (l *messageLog) advance(cs *consumerState) {
+	for _, e := range l.entries {
+		if e.seq <= cs.cursor {
+			continue
+		}
+
+		if !cs.done[e.seq] && !e.released {
+			break
+		}
+
+		cs.cursor = e.seq
+		delete(cs.done, e.seq)
+	}
+}
+
+// trim releases the entries that every consumer has consumed, they are
+// removed unless the log retains them.
+func (l *messageLog) trim() {
+	if len(l.consumers) == 0 {
+		return
+	}
+
+	consumedByAll := func(e logEntry) bool {
+		for _, cs := range l.consumers {
+			if !cs.consumed(e.seq) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if !l.retain {
+		l.remove(consumedByAll)
+
+		return
+	}
+
+	for i := range l.entries {
+		if !l.entries[i].released && consumedByAll(l.entries[i]) {
+			l.entries[i].released = true
+		}
+	}
+}
+
+func (l *messageLog) remove(match func(logEntry) bool) {
+	var removed []uint64
+
+	l.entries = slices.DeleteFunc(l.entries, func(e logEntry) bool {
+		if match(e) {
+			removed = append(removed, e.seq)
+
+			return true
+		}
+
+		return false
+	})
+
+	if len(removed) == 0 {
+		return
+	}
+
+	for _, cs := range l.consumers {
+		for _, seq := range removed {
+			delete(cs.done, seq)
+		}
+
+		l.advance(cs)
+	}
+
+	l.trim()
+}
+
+// pending returns the entries that the consumer has not consumed yet.
+// ErrConsumerNotFound is returned if the consumer does not exist.
+func (l *messageLog) pending(consumer string) ([]logEntry, error) {
+	cs, ok := l.consumers[consumer]
+	if !ok {
+		return nil, ErrConsumerNotFound
+	}
+
+	var entries []logEntry
+
+	for _, e := range l.entries {
+		if !e.released && !cs.consumed(e.seq) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+// queued returns the entries that are not released.
+func (l *messageLog) queued() []logEntry {
+	var entries []logEntry
+
+	for _, e := range l.entries {
+		if !e.released {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// snapshot returns the journal entries that rebuild the log as it is now.
+func (l *messageLog) snapshot() []journalEntry {
+	entries := make([]journalEntry, 0, 1+len(l.consumers)+len(l.entries))
+	entries = append(entries, journalEntry{Op: journalOpSequence, Seq: l.lastSeq})
+
+	for name, cs := range l.consumers {
+		done := make([]uint64, 0, len(cs.done))
+		for seq := range cs.done {
+			done = append(done, seq)
+		}
+
+		slices.Sort(done)
+
+		entries = append(entries, journalEntry{Op: journalOpConsumer, Consumer: name, Seq: cs.cursor, Seqs: done})
+	}
+
+	for i := range l.entries {
+		e := &l.entries[i]
+
+		var at int64
+		if !e.at.IsZero() {
+			at = e.at.UnixMilli()
+		}
+
+		entries = append(entries, journalEntry{
+			Op:       journalOpAppend,
+			Seq:      e.seq,
+			Message:  &e.msg,
+			At:       at,
+			Released: e.released,
+		})
+	}
+
+	return entries
+}
+
+type lease struct {
+	consumer string
+	seq      uint64
+	until    time.Time
+}
+
+// logStore implements MessageStore on top of a messageLog. Every mutation is
+// handed to persist, if set, before it is applied.
+type logStore struct {
+	mu      sync.Mutex
+	log     messageLog
+	persist func(journalEntry) error
+
+	// retention is how long the released entries are kept as history.
+	retention time.Duration
+
+	// leases maps receipt handles to the leased entries.
+	leases map[string]lease
+}
+
+func (s *logStore) init(opts StoreOptions) {
+	s.log = newMessageLog(opts.HistoryRetention > 0)
+	s.retention = opts.HistoryRetention
+
+	if opts.FirstID > 0 {
+		s.log.lastSeq = opts.FirstID - 1
+	}
+}
+
+// sweep removes the released entries that are older than the retention. The
+// removal is journaled, so replaying the journal does not depend on the time.
+func (s *logStore) sweep() error {
+	if !s.log.retain {
+		return nil
+	}
+
+	deadline := time.Now().Add(-s.retention)
+
+	var seqs []uint64
+
+	for _, e := range s.log.entries {
+		if e.released && e.at.Before(deadline) {
+			seqs = append(seqs, e.seq)
+		}
+	}
+
+	if len(seqs) == 0 {
+		return nil
+	}
+
+	return s.commit(journalEntry{Op: journalOpDelete, Seqs: seqs})
+}
+
+// visible returns the entries pending for the consumer that are not leased.
+// Expired leases are dropped along the way.
+func (s *logStore) visible(consumer string) ([]logEntry, error) {
+	pending, err := s.log.pending(consumer)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	leased := make(map[uint64]bool)
+
+	for handle, l := range s.leases {
+		if !now.Before(l.until) {
+			delete(s.leases, handle)
+
+			continue
+		}
+
+		if l.consumer == consumer {
+			leased[l.seq] = true
+		}
+	}
+
+	if len(leased) == 0 {
+		return pending, nil
+	}
+
+	visible := make([]logEntry, 0, len(pending))
+
+	for _, e := range pending {
+		if !leased[e.seq] {
+			visible = append(visible, e)
+		}
+	}
+
+	return visible, nil
+}
+
+// matching returns the entries whose message matches, all of them if match is
+// nil.
+func matching(entries []logEntry, match func(Message) bool) []logEntry {
+	if match == nil {
+		return entries
+	}
+
+	return slices.DeleteFunc(entries, func(e logEntry) bool { return !match(e.msg) })
+}
+
+func (s *logStore) commit(entries ...journalEntry) error {
+	for _, entry := range entries {
+		if s.persist != nil {
+			if err := s.persist(entry); err != nil {
+				return err
+			}
+		}
+
+		s.log.apply(entry)
+	}
+
+	return nil
+}
+
+// consume consumes the entries for the consumer. View-once messages are
+// removed from the log as soon as a consumer consumed them.
+func (s *logStore) consume(consumer string, entries []logEntry) error {
+	var consumed, viewOnce []uint64
+
+	for _, e := range entries {
+		if e.msg.IsViewOnce() {
+			viewOnce = append(viewOnce, e.seq)
+		} else {
+			consumed = append(consumed, e.seq)
+		}
+	}
+
+	ops := make([]journalEntry, 0, 2)
+
+	if len(consumed) > 0 {
+		ops = append(ops, journalEntry{Op: journalOpConsume, Consumer: consumer, Seqs: consumed})
+	}
+
+	if len(viewOnce) > 0 {
+		ops = append(ops, journalEntry{Op: journalOpDelete, Seqs: viewOnce})
+	}
+
+	return s.commit(ops...)
+}
+
+// Append implements MessageStore.
+func (s *logStore) Append(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.sweep(); err != nil {
+		return err
+	}
+
+	seq := s.log.lastSeq + 1
+
+	if err := s.commit(journalEntry{
+		Op:      journalOpAppend,
+		Seq:     seq,
+		Message: msg,
+		At:      time.Now().UnixMilli(),
+	}); err != nil {
+		return err
+	}
+
+	msg.ID = seq
+
+	return nil
+}
+
+// Pop implements MessageStore.
+func (s *logStore) Pop(consumer string, match func(Message) bool) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	visible, err := s.visible(consumer)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := matching(visible, match)
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	msg := pending[0].msg
+
+	if err := s.consume(consumer, pending[:1]); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// Flush implements MessageStore.
+func (s *logStore) Flush(consumer string, match func(Message) bool) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	visible, err := s.visible(consumer)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := matching(visible, match)
+
+	msgs := make([]Message, 0, len(pending))
+	for _, e := range pending {
+		msgs = append(msgs, e.msg)
+	}
+
+	if err := s.consume(consumer, pending); err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+// Lease implements MessageStore.
+func (s *logStore) Lease(consumer string, timeout time.Duration) (*Message, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, err := s.visible(consumer)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(pending) == 0 {
+		return nil, "", nil
+	}
+
+	if s.leases == nil {
+		s.leases = make(map[string]lease)
+	}
+
+	handle := rand.Text()
+	s.leases[handle] = lease{consumer: consumer, seq: pending[0].seq, until: time.Now().Add(timeout)}
+
+	msg := pending[0].msg
+
+	return &msg, handle, nil
+}
+
+// Ack implements MessageStore.
+func (s *logStore) Ack(handle string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.leases[handle]
+	if !ok || !time.Now().Before(l.until) {
+		delete(s.leases, handle)
+
+		return ErrLeaseNotFound
+	}
+
+	delete(s.leases, handle)
+
+	for _, e := range s.log.entries {
+		if e.seq == l.seq {
+			return s.consume(l.consumer, []logEntry{e})
+		}
+	}
+
+	// the message was removed from the log while it was leased.
+	return nil
+}
+
+// Peek implements MessageStore.
+func (s *logStore) Peek(consumer string, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, err := s.log.pending(consumer)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > len(pending) {
+		limit = len(pending)
+	}
+
+	msgs := make([]Message, 0, limit)
+	for _, e := range pending[:limit] {
+		msgs = append(msgs, e.msg)
+	}
+
+	return msgs, nil
+}
+
+// Count implements MessageStore.
+func (s *logStore) Count(consumer string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, err := s.log.pending(consumer)
+
+	return len(pending), err
+}
+
+// Since implements MessageStore.
+func (s *logStore) Since(cursor uint64, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.sweep(); err != nil {
+		return nil, err
+	}
+
+	var msgs []Message
+
+	for _, e := range s.log.entries {
+		if limit > 0 && len(msgs) == limit {
+			break
+		}
+
+		if e.seq > cursor && !e.msg.IsViewOnce() {
+			msgs = append(msgs, e.msg)
+		}
+	}
+
+	return msgs, nil
+}
+
+// LastID implements MessageStore.
+func (s *logStore) LastID() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.log.lastSeq, nil
+}
+
+// Len implements MessageStore.
+func (s *logStore) Len() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.log.queued()), nil
+}
+
+// Delete implements MessageStore.
+func (s *logStore) Delete(match func(Message) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var seqs []uint64
+
+	for _, e := range s.log.entries {
+		if match(e.msg) {
+			seqs = append(seqs, e.seq)
+		}
+	}
+
+	if len(seqs) == 0 {
+		return 0, nil
+	}
+
+	return len(seqs), s.commit(journalEntry{Op: journalOpDelete, Seqs: seqs})
+}
+
+// Update implements MessageStore.
+func (s *logStore) Update(match func(Message) bool, update func(*Message)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ops []journalEntry
+
+	for _, e := range s.log.entries {
+		if !match(e.msg) {
+			continue
+		}
+
+		msg := e.msg
+		update(&msg)
+
+		ops = append(ops, journalEntry{Op: journalOpUpdate, Seq: e.seq, Message: &msg})
+	}
+
+	return len(ops), s.commit(ops...)
+}
+
+// Trim implements MessageStore.
+func (s *logStore) Trim(n int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queued := s.log.queued()
+
+	n = min(n, len(queued))
+	if n <= 0 {
+		return 0, nil
+	}
+
+	seqs := make([]uint64, 0, n)
+	for _, e := range queued[:n] {
+		seqs = append(seqs, e.seq)
+	}
+
+	return n, s.commit(journalEntry{Op: journalOpDelete, Seqs: seqs})
+}
+
+// Evict implements MessageStore.
+func (s *logStore) Evict(match func(Message) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var seqs []uint64
+
+	for _, e := range s.log.queued() {
+		if match(e.msg) {
+			seqs = append(seqs, e.seq)
+		}
+	}
+
+	if len(seqs) == 0 {
+		return 0, nil
+	}
+
+	return len(seqs), s.commit(journalEntry{Op: journalOpDelete, Seqs: seqs})
+}
+
+// AddConsumer implements MessageStore.
+func (s *logStore) AddConsumer(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.log.consumers[name]; ok {
+		return nil
+	}
+
+	return s.commit(journalEntry{Op: journalOpConsumer, Consumer: name})
+}
+
+// Consumers implements MessageStore.
+func (s *logStore) Consumers() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(s.log.consumers)), nil
+}
+
+// RemoveConsumer implements MessageStore.
+func (s *logStore) RemoveConsumer(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.log.consumers[name]; !ok {
+		return ErrConsumerNotFound
+	}
+
+	for handle, l := range s.leases {
+		if l.consumer == name {
+			delete(s.leases, handle)
+		}
+	}
+
+	return s.commit(journalEntry{Op: journalOpRemove, Consumer: name})
+}
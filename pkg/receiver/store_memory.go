@@ -0,0 +1,18 @@
+package receiver
+
+// MemoryStore is a MessageStore that keeps the messages in memory, they are
+// lost when the process exits.
+type MemoryStore struct {
+	logStore
+}
+
+// NewMemoryStore returns a new empty MemoryStore.
+func NewMemoryStore(opts StoreOptions) *MemoryStore {
+	ms := &MemoryStore{}
+	ms.init(opts)
+
+	return ms
+}
+
+// Close implements MessageStore.
+func (ms *MemoryStore) Close() error { return nil }
@@ -0,0 +1,358 @@
+//nolint:testpackage
+package receiver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageStore(t *testing.T) {
+	t.Parallel()
+
+	for name, newStore := range storeBackends() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			t.Run("peek does not remove messages", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t, Message{Account: "0"}, Message{Account: "1"}, Message{Account: "2"})
+
+				msgs, err := store.Peek(DefaultConsumer, 2)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 1, Account: "0"}, {ID: 2, Account: "1"}}, msgs)
+
+				msgs, err = store.Peek(DefaultConsumer, 0)
+				require.NoError(t, err)
+				assert.Len(t, msgs, 3)
+
+				n, err := store.Count(DefaultConsumer)
+				require.NoError(t, err)
+				assert.Equal(t, 3, n)
+			})
+
+			t.Run("pop and flush only consume the matching messages", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t,
+					Message{Account: "0"}, Message{Account: "1"}, Message{Account: "0"}, Message{Account: "2"})
+
+				match := func(m Message) bool { return m.Account == "0" }
+
+				msg, err := store.Pop(DefaultConsumer, match)
+				require.NoError(t, err)
+				assert.Equal(t, &Message{ID: 1, Account: "0"}, msg)
+
+				msgs, err := store.Flush(DefaultConsumer, match)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 3, Account: "0"}}, msgs)
+
+				msg, err = store.Pop(DefaultConsumer, match)
+				require.NoError(t, err)
+				assert.Nil(t, msg)
+
+				msgs, err = store.Flush(DefaultConsumer, nil)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 2, Account: "1"}, {ID: 4, Account: "2"}}, msgs)
+			})
+
+			t.Run("delete removes matching messages only", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t, Message{Account: "0"}, Message{Account: "1"}, Message{Account: "0"})
+
+				n, err := store.Delete(func(m Message) bool { return m.Account == "0" })
+				require.NoError(t, err)
+				assert.Equal(t, 2, n)
+
+				msgs, err := store.Flush(DefaultConsumer, nil)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 2, Account: "1"}}, msgs)
+			})
+
+			t.Run("update replaces matching messages and keeps their ID", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t, Message{Account: "0"}, Message{Account: "1"})
+
+				n, err := store.Update(
+					func(m Message) bool { return m.Account == "1" },
+					func(m *Message) { m.Account = "edited" },
+				)
+				require.NoError(t, err)
+				assert.Equal(t, 1, n)
+
+				msgs, err := store.Flush(DefaultConsumer, nil)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 1, Account: "0"}, {ID: 2, Account: "edited"}}, msgs)
+			})
+
+			t.Run("every consumer sees every message once", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t)
+				require.NoError(t, store.AddConsumer("ha"))
+
+				require.NoError(t, store.Append(&Message{Account: "0"}))
+				require.NoError(t, store.Append(&Message{Account: "1"}))
+
+				msg, err := store.Pop("ha", nil)
+				require.NoError(t, err)
+				assert.Equal(t, &Message{ID: 1, Account: "0"}, msg)
+
+				msgs, err := store.Flush(DefaultConsumer, nil)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 1, Account: "0"}, {ID: 2, Account: "1"}}, msgs)
+
+				// the first message was consumed by everyone, it is gone from the log.
+				n, err := store.Len()
+				require.NoError(t, err)
+				assert.Equal(t, 1, n)
+
+				msgs, err = store.Flush("ha", nil)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 2, Account: "1"}}, msgs)
+
+				n, err = store.Len()
+				require.NoError(t, err)
+				assert.Zero(t, n)
+			})
+
+			t.Run("an unknown consumer is refused", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t, Message{Account: "0"})
+
+				_, err := store.Pop("typo", nil)
+				require.ErrorIs(t, err, ErrConsumerNotFound)
+
+				_, err = store.Flush("typo", nil)
+				require.ErrorIs(t, err, ErrConsumerNotFound)
+
+				_, _, err = store.Lease("typo", time.Minute)
+				require.ErrorIs(t, err, ErrConsumerNotFound)
+
+				_, err = store.Peek("typo", 0)
+				require.ErrorIs(t, err, ErrConsumerNotFound)
+
+				_, err = store.Count("typo")
+				require.ErrorIs(t, err, ErrConsumerNotFound)
+
+				require.ErrorIs(t, store.RemoveConsumer("typo"), ErrConsumerNotFound)
+
+				consumers, err := store.Consumers()
+				require.NoError(t, err)
+				assert.Equal(t, []string{DefaultConsumer}, consumers)
+
+				// the message is only kept for the default consumer.
+				_, err = store.Flush(DefaultConsumer, nil)
+				require.NoError(t, err)
+
+				n, err := store.Len()
+				require.NoError(t, err)
+				assert.Zero(t, n)
+			})
+
+			t.Run("removing a consumer releases its messages", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t)
+				require.NoError(t, store.AddConsumer(DefaultConsumer))
+				require.NoError(t, store.AddConsumer("ha"))
+
+				require.NoError(t, store.Append(&Message{Account: "0"}))
+
+				_, err := store.Flush(DefaultConsumer, nil)
+				require.NoError(t, err)
+
+				n, err := store.Len()
+				require.NoError(t, err)
+				assert.Equal(t, 1, n)
+
+				require.NoError(t, store.RemoveConsumer("ha"))
+
+				n, err = store.Len()
+				require.NoError(t, err)
+				assert.Zero(t, n)
+			})
+
+			t.Run("a view-once message is consumed once", func(t *testing.T) {
+				t.Parallel()
+
+				viewOnce := Message{Envelope: Envelope{DataMessage: &DataMessage{ViewOnce: true}}}
+
+				store := newStore(t)
+				require.NoError(t, store.AddConsumer("ha"))
+				require.NoError(t, store.AddConsumer("node-red"))
+				require.NoError(t, store.Append(&viewOnce))
+
+				msg, err := store.Pop("ha", nil)
+				require.NoError(t, err)
+				require.NotNil(t, msg)
+				assert.Equal(t, viewOnce.Envelope, msg.Envelope)
+
+				msg, err = store.Pop("node-red", nil)
+				require.NoError(t, err)
+				assert.Nil(t, msg)
+			})
+
+			t.Run("a leased message is hidden until it is acked", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t, Message{Account: "0"}, Message{Account: "1"})
+
+				msg, handle, err := store.Lease(DefaultConsumer, time.Minute)
+				require.NoError(t, err)
+				assert.Equal(t, &Message{ID: 1, Account: "0"}, msg)
+				assert.NotEmpty(t, handle)
+
+				msgs, err := store.Flush(DefaultConsumer, nil)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 2, Account: "1"}}, msgs)
+
+				require.NoError(t, store.Ack(handle))
+				require.ErrorIs(t, store.Ack(handle), ErrLeaseNotFound)
+
+				n, err := store.Len()
+				require.NoError(t, err)
+				assert.Zero(t, n)
+			})
+
+			t.Run("a message is delivered again once its lease expires", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t, Message{Account: "0"})
+
+				_, handle, err := store.Lease(DefaultConsumer, time.Millisecond)
+				require.NoError(t, err)
+
+				time.Sleep(10 * time.Millisecond)
+
+				require.ErrorIs(t, store.Ack(handle), ErrLeaseNotFound)
+
+				msg, err := store.Pop(DefaultConsumer, nil)
+				require.NoError(t, err)
+				assert.Equal(t, &Message{ID: 1, Account: "0"}, msg)
+			})
+
+			t.Run("leasing an empty queue returns no handle", func(t *testing.T) {
+				t.Parallel()
+
+				store := newStore(t)
+
+				msg, handle, err := store.Lease(DefaultConsumer, time.Minute)
+				require.NoError(t, err)
+				assert.Nil(t, msg)
+				assert.Empty(t, handle)
+			})
+
+			t.Run("since returns the messages after the cursor", func(t *testing.T) {
+				t.Parallel()
+
+				viewOnce := Message{Envelope: Envelope{DataMessage: &DataMessage{ViewOnce: true}}}
+
+				store := newStore(t, Message{Account: "0"}, viewOnce, Message{Account: "2"}, Message{Account: "3"})
+
+				msgs, err := store.Since(0, 2)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 1, Account: "0"}, {ID: 3, Account: "2"}}, msgs)
+
+				msgs, err = store.Since(3, 0)
+				require.NoError(t, err)
+				assert.Equal(t, []Message{{ID: 4, Account: "3"}}, msgs)
+
+				// since does not consume the messages.
+				n, err := store.Count(DefaultConsumer)
+				require.NoError(t, err)
+				assert.Equal(t, 4, n)
+			})
+		})
+	}
+}
+
+func TestMessageStoreHistory(t *testing.T) {
+	t.Parallel()
+
+	for name, newStore := range storeBackendsWithOptions(StoreOptions{HistoryRetention: time.Hour}) {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			store := newStore(t)
+			require.NoError(t, store.AddConsumer(DefaultConsumer))
+			require.NoError(t, store.Append(&Message{Account: "0"}))
+			require.NoError(t, store.Append(&Message{Account: "1"}))
+
+			msgs, err := store.Flush(DefaultConsumer, nil)
+			require.NoError(t, err)
+			assert.Len(t, msgs, 2)
+
+			// the consumed messages are kept as history only.
+			n, err := store.Len()
+			require.NoError(t, err)
+			assert.Zero(t, n)
+
+			require.NoError(t, store.AddConsumer("ha"))
+
+			msgs, err = store.Flush("ha", nil)
+			require.NoError(t, err)
+			assert.Empty(t, msgs)
+
+			msgs, err = store.Since(1, 0)
+			require.NoError(t, err)
+			assert.Equal(t, []Message{{ID: 2, Account: "1"}}, msgs)
+		})
+	}
+
+	t.Run("the IDs keep increasing across a restart", func(t *testing.T) {
+		t.Parallel()
+
+		// the memory store is seeded from the clock, like serve does.
+		clock := func() uint64 { return uint64(time.Now().UnixMicro()) } //nolint:gosec // past the epoch.
+
+		store := NewMemoryStore(StoreOptions{FirstID: clock()})
+		require.NoError(t, store.AddConsumer(DefaultConsumer))
+
+		for _, a := range []string{"0", "1"} {
+			require.NoError(t, store.Append(&Message{Account: a}))
+		}
+
+		msgs, err := store.Since(0, 0)
+		require.NoError(t, err)
+		require.Len(t, msgs, 2)
+
+		cursor := msgs[1].ID
+
+		time.Sleep(time.Millisecond)
+
+		store = NewMemoryStore(StoreOptions{FirstID: clock()})
+		require.NoError(t, store.AddConsumer(DefaultConsumer))
+		require.NoError(t, store.Append(&Message{Account: "2"}))
+
+		// the cursor from before the restart does not skip the new message.
+		msgs, err = store.Since(cursor, 0)
+		require.NoError(t, err)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, "2", msgs[0].Account)
+		assert.Greater(t, msgs[0].ID, cursor)
+	})
+
+	t.Run("history older than the retention is removed", func(t *testing.T) {
+		t.Parallel()
+
+		store := NewMemoryStore(StoreOptions{HistoryRetention: time.Millisecond})
+		require.NoError(t, store.AddConsumer(DefaultConsumer))
+		require.NoError(t, store.Append(&Message{Account: "0"}))
+
+		_, err := store.Flush(DefaultConsumer, nil)
+		require.NoError(t, err)
+
+		time.Sleep(10 * time.Millisecond)
+
+		msgs, err := store.Since(0, 0)
+		require.NoError(t, err)
+		assert.Empty(t, msgs)
+	})
+}
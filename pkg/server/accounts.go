@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/receiver"
+)
+
+// routeAccount prefixes the routes scoped to an account. Accounts are phone
+// numbers starting with a plus sign, so they are not mistaken for consumers
+// whose names start with a letter or a digit.
+const routeAccount = `/receive/{account:\+[0-9]+}`
+
+var errAccountNotFound = errors.New("account not found")
+
+type accountKey struct{}
+
+// Account is the state of the server for a Signal account: the client
+// receiving its messages, the messages repeated to its consumers and the
+// subscribers of its events.
+type Account struct {
+	sarc client
+
+	lastMu sync.Mutex
+	last   map[string]*receiver.Message
+
+	events *broker
+}
+
+func newAccount(sarc client) *Account {
+	return &Account{
+		sarc:   sarc,
+		last:   make(map[string]*receiver.Message),
+		events: newBroker(),
+	}
+}
+
+// WithAccount serves the messages of the account received by sarc under
+// /receive/{account}/..., e.g. /receive/+15551234567/pop. The client given to
+// New is the default account served by the routes that are not scoped, pass it
+// to WithAccount as well to serve it under its name too.
+func WithAccount(name string, sarc client) Option {
+	return func(s *Server) {
+		a := s.defaultAccount
+		if sarc != a.sarc {
+			a = newAccount(sarc)
+		}
+
+		s.accounts[name] = a
+	}
+}
+
+// Account returns the account with the name, or nil if it is not served. It
+// handles the notifier payloads of the account's client to stream its events.
+func (s *Server) Account(name string) *Account {
+	return s.accounts[name]
+}
+
+// accountRoute scopes the route to an account, e.g. /receive/pop becomes
+// /receive/{account}/pop and /consumers/{consumer} becomes
+// /receive/{account}/consumers/{consumer}.
+func accountRoute(route string) string {
+	return routeAccount + strings.TrimPrefix(route, "/receive")
+}
+
+// resolveAccount looks the account named in the route up, or takes the default
+// account for the routes that are not scoped to an account, and passes it on to
+// the handler in the request context.
+func (s *Server) resolveAccount(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := s.defaultAccount
+
+		if name := chi.URLParam(r, "account"); name != "" {
+			a = s.accounts[name]
+			if a == nil {
+				http.Error(w, errAccountNotFound.Error(), http.StatusNotFound)
+
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accountKey{}, a)))
+	})
+}
+
+// requestAccount returns the account resolved for the request.
+func (s *Server) requestAccount(r *http.Request) *Account {
+	if a, ok := r.Context().Value(accountKey{}).(*Account); ok {
+		return a
+	}
+
+	return s.defaultAccount
+}
+
+// storeLast remembers the last of msgs so it may be repeated to the consumer.
+// A view-once message is never repeated, and neither is anything older than it.
+func (a *Account) storeLast(consumer string, msgs []receiver.Message) {
+	if len(msgs) == 0 {
+		return
+	}
+
+	a.lastMu.Lock()
+	defer a.lastMu.Unlock()
+
+	last := msgs[len(msgs)-1]
+	if last.IsViewOnce() {
+		delete(a.last, consumer)
+
+		return
+	}
+
+	a.last[consumer] = &last
+}
+
+// lastMessage returns the message to repeat to the consumer, unless it is a
+// disappearing message that has expired since.
+func (a *Account) lastMessage(consumer string) *receiver.Message {
+	a.lastMu.Lock()
+	defer a.lastMu.Unlock()
+
+	msg := a.last[consumer]
+	if msg != nil && msg.IsExpired(time.Now()) {
+		delete(a.last, consumer)
+
+		return nil
+	}
+
+	return msg
+}
+
+// forgetLast stops repeating a message to the consumer.
+func (a *Account) forgetLast(consumer string) {
+	a.lastMu.Lock()
+	defer a.lastMu.Unlock()
+
+	delete(a.last, consumer)
+}
@@ -0,0 +1,155 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/receiver"
+	"github.com/kalbasit/signal-api-receiver/pkg/server"
+)
+
+func TestAccounts(t *testing.T) {
+	t.Parallel()
+
+	const (
+		household = "+15550000001"
+		alerts    = "+15550000002"
+	)
+
+	newServer := func(t *testing.T) (*server.Server, *storeClient) {
+		t.Helper()
+
+		hc := newStoreClient(t, receiver.Message{Account: household}, receiver.Message{Account: household})
+		ac := newStoreClient(t, receiver.Message{Account: alerts})
+
+		for _, sc := range []*storeClient{hc, ac} {
+			require.NoError(t, sc.store.AddConsumer("alice"))
+		}
+
+		s := server.New(newContext(), hc, false,
+			server.WithAccount(household, hc),
+			server.WithAccount(alerts, ac),
+		)
+
+		return s, ac
+	}
+
+	pop := func(t *testing.T, url string) (int, receiver.Message) {
+		t.Helper()
+
+		//nolint:noctx
+		resp, err := http.Get(url)
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		var msg receiver.Message
+
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg))
+		}
+
+		return resp.StatusCode, msg
+	}
+
+	t.Run("the routes are scoped to the account", func(t *testing.T) {
+		t.Parallel()
+
+		s, _ := newServer(t)
+
+		hs := httptest.NewServer(s)
+		defer hs.Close()
+
+		code, msg := pop(t, hs.URL+"/receive/"+alerts+"/pop")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, receiver.Message{ID: 1, Account: alerts}, msg)
+
+		code, msg = pop(t, hs.URL+"/receive/"+alerts+"/pop")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, receiver.Message{}, msg)
+
+		code, msg = pop(t, hs.URL+"/receive/"+household+"/pop")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, receiver.Message{ID: 1, Account: household}, msg)
+
+		// the unscoped routes serve the default account.
+		code, msg = pop(t, hs.URL+"/receive/pop")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, receiver.Message{ID: 2, Account: household}, msg)
+	})
+
+	t.Run("the consumers are scoped to the account", func(t *testing.T) {
+		t.Parallel()
+
+		s, _ := newServer(t)
+
+		hs := httptest.NewServer(s)
+		defer hs.Close()
+
+		//nolint:noctx
+		resp, err := http.Get(hs.URL + "/receive/" + alerts + "/alice/count")
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		var count struct {
+			Count int `json:"count"`
+		}
+
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&count))
+		assert.Equal(t, 1, count.Count)
+
+		code, msg := pop(t, hs.URL+"/receive/"+alerts+"/alice/pop")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, receiver.Message{ID: 1, Account: alerts}, msg)
+
+		code, msg = pop(t, hs.URL+"/receive/alice/pop")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, receiver.Message{ID: 1, Account: household}, msg)
+	})
+
+	t.Run("an unknown account is not found", func(t *testing.T) {
+		t.Parallel()
+
+		s, _ := newServer(t)
+
+		hs := httptest.NewServer(s)
+		defer hs.Close()
+
+		code, _ := pop(t, hs.URL+"/receive/+15550000009/pop")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("every account is checked", func(t *testing.T) {
+		t.Parallel()
+
+		s, ac := newServer(t)
+		ac.disconnected.Store(true)
+
+		hs := httptest.NewServer(s)
+		defer hs.Close()
+
+		code, got := getHealth(t, hs.URL+"/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "pass", got.Checks["signal-api"].Status)
+		assert.Equal(t, "fail", got.Checks["signal-api/"+alerts].Status)
+		assert.Contains(t, got.Checks, "last-frame/"+alerts)
+		assert.NotContains(t, got.Checks, "signal-api/"+household)
+	})
+
+	t.Run("the default account is served under its name", func(t *testing.T) {
+		t.Parallel()
+
+		s, _ := newServer(t)
+
+		require.NotNil(t, s.Account(household))
+		require.NotNil(t, s.Account(alerts))
+		assert.NotSame(t, s.Account(household), s.Account(alerts))
+		assert.Nil(t, s.Account("+15550000009"))
+	})
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Scope is the access an API key grants.
+type Scope string
+
+const (
+	// ScopeRead grants access to the routes that do not consume messages, such
+	// as the health check and the inspection routes.
+	ScopeRead Scope = "read"
+
+	// ScopeConsume grants access to every route, including the routes that
+	// consume messages such as pop and flush.
+	ScopeConsume Scope = "consume"
+)
+
+// ErrInvalidAPIKey is returned if an API key entry cannot be parsed.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeys maps the API keys to the scope they grant.
+type APIKeys map[string]Scope
+
+// ParseAPIKeys parses API key entries of the form "<key>[:<scope>]". A key
+// without a scope grants the consume scope.
+func ParseAPIKeys(entries []string) (APIKeys, error) {
+	keys := make(APIKeys, len(entries))
+
+	for _, entry := range entries {
+		key, scope, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found {
+			scope = string(ScopeConsume)
+		}
+
+		if key == "" {
+			return nil, fmt.Errorf("%w: the key is empty", ErrInvalidAPIKey)
+		}
+
+		switch Scope(scope) {
+		case ScopeRead, ScopeConsume:
+			keys[key] = Scope(scope)
+		default:
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, scope)
+		}
+	}
+
+	return keys, nil
+}
+
+// LoadAPIKeys reads the API key entries from a file, one "<key>[:<scope>]" per
+// line. Blank lines and lines starting with # are ignored.
+func LoadAPIKeys(path string) (APIKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the API keys file: %w", err)
+	}
+
+	defer f.Close()
+
+	var entries []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entries = append(entries, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the API keys file: %w", err)
+	}
+
+	return ParseAPIKeys(entries)
+}
+
+// scope returns the scope granted to the key, and false if the key is unknown.
+// Every key is compared so the time taken does not depend on the key.
+func (keys APIKeys) scope(key string) (Scope, bool) {
+	var (
+		granted Scope
+		found   bool
+	)
+
+	for k, scope := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			granted, found = scope, true
+		}
+	}
+
+	return granted, found
+}
+
+type scopeKey struct{}
+
+// requestKey returns the API key of the request, set either as a bearer token
+// or with the X-API-Key header.
+func requestKey(r *http.Request) string {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(key)
+	}
+
+	return r.Header.Get("X-API-Key")
+}
+
+// authenticate rejects the requests that do not carry a known API key, and
+// records the scope of the key for requireScope.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := s.apiKeys.scope(requestKey(r))
+		if !ok {
+			s.logger.Warn().
+				Str("method", r.Method).
+				Str("request-uri", r.RequestURI).
+				Str("from", r.RemoteAddr).
+				Str("reqID", middleware.GetReqID(r.Context())).
+				Msg("rejected a request without a valid API key")
+
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeKey{}, scope)))
+	})
+}
+
+// requireScope rejects the requests whose API key does not grant the scope. It
+// lets every request through if authentication is disabled.
+func (s *Server) requireScope(scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(s.apiKeys) > 0 && !grants(r.Context(), scope) {
+				s.logger.Warn().
+					Str("method", r.Method).
+					Str("request-uri", r.RequestURI).
+					Str("from", r.RemoteAddr).
+					Str("reqID", middleware.GetReqID(r.Context())).
+					Str("scope", string(scope)).
+					Msg("rejected a request whose API key does not grant the scope")
+
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// grants returns true if the scope of the request includes scope. The consume
+// scope includes the read scope.
+func grants(ctx context.Context, scope Scope) bool {
+	granted, _ := ctx.Value(scopeKey{}).(Scope)
+
+	return granted == scope || granted == ScopeConsume
+}
@@ -0,0 +1,147 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/server"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	keys, err := server.ParseAPIKeys([]string{"full", "reader:read", "consumer:consume"})
+	require.NoError(t, err)
+	assert.Equal(t, server.APIKeys{
+		"full":     server.ScopeConsume,
+		"reader":   server.ScopeRead,
+		"consumer": server.ScopeConsume,
+	}, keys)
+
+	for _, entry := range []string{"", ":read", "key:admin"} {
+		_, err := server.ParseAPIKeys([]string{entry})
+		require.ErrorIs(t, err, server.ErrInvalidAPIKey, entry)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "api-keys")
+	require.NoError(t, os.WriteFile(path, []byte("# dashboards\nreader:read\n\nfull\n"), 0o600))
+
+	keys, err := server.LoadAPIKeys(path)
+	require.NoError(t, err)
+	assert.Equal(t, server.APIKeys{"reader": server.ScopeRead, "full": server.ScopeConsume}, keys)
+
+	_, err = server.LoadAPIKeys(filepath.Join(t.TempDir(), "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use, to collect the
+// logs of the server.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Parallel()
+
+	var logs syncBuffer
+
+	ctx := zerolog.New(&logs).WithContext(context.Background())
+
+	hs := httptest.NewServer(server.New(ctx, newStoreClient(t), false, server.WithAPIKeys(server.APIKeys{
+		"reader":   server.ScopeRead,
+		"consumer": server.ScopeConsume,
+	})))
+	defer hs.Close()
+
+	status := func(t *testing.T, route string, header http.Header) int {
+		t.Helper()
+
+		r, err := http.NewRequestWithContext(context.Background(), http.MethodGet, hs.URL+route, nil)
+		require.NoError(t, err)
+
+		r.Header = header
+
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	bearer := func(key string) http.Header { return http.Header{"Authorization": {"Bearer " + key}} }
+	apiKey := func(key string) http.Header { return http.Header{"X-Api-Key": {key}} }
+
+	tests := []struct {
+		name   string
+		route  string
+		header http.Header
+		want   int
+	}{
+		{"no key", "/healthz", nil, http.StatusUnauthorized},
+		{"unknown key", "/receive/pop", bearer("typo"), http.StatusUnauthorized},
+		{"read key on health", "/healthz", bearer("reader"), http.StatusOK},
+		{"read key on count", "/receive/count", apiKey("reader"), http.StatusOK},
+		{"read key on pop", "/receive/pop", bearer("reader"), http.StatusForbidden},
+		{"read key on scoped flush", "/receive/ha/flush", apiKey("reader"), http.StatusForbidden},
+		{"consume key on pop", "/receive/pop", bearer("consumer"), http.StatusOK},
+		{"consume key on peek", "/receive/peek", apiKey("consumer"), http.StatusOK},
+		{"read key on metrics", "/metrics", bearer("reader"), http.StatusOK},
+		{"no key on metrics", "/metrics", nil, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, status(t, test.route, test.header), test.name)
+	}
+
+	assert.Contains(t, logs.String(), "rejected a request without a valid API key")
+	assert.Contains(t, logs.String(), "rejected a request whose API key does not grant the scope")
+	assert.Contains(t, logs.String(), `"reqID":"`)
+	assert.NotContains(t, logs.String(), `"reqID":""`)
+}
+
+func TestNoAuthentication(t *testing.T) {
+	t.Parallel()
+
+	hs := httptest.NewServer(server.New(newContext(), newStoreClient(t), false))
+	defer hs.Close()
+
+	for _, route := range []string{"/healthz", "/receive/pop"} {
+		//nolint:noctx
+		resp, err := http.Get(hs.URL + route)
+		require.NoError(t, err)
+
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, route)
+	}
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/receiver"
+)
+
+const (
+	routeReceiveEvents = "/receive/events"
+
+	// eventsBuffer is the number of events buffered for a subscriber, a
+	// subscriber that falls further behind is disconnected and resumes with
+	// Last-Event-ID. The messages are buffered by the receiver.
+	eventsBuffer = 64
+
+	// eventsKeepAlive is how often a comment is sent to idle subscribers so
+	// proxies do not close the stream.
+	eventsKeepAlive = 30 * time.Second
+
+	eventConnected    = "connected"
+	eventDisconnected = "disconnected"
+	eventReconnecting = "reconnecting"
+	eventDeleted      = "deleted"
+	eventEdited       = "edited"
+)
+
+// event is a Server-Sent Event. Message events carry the ID of the message so
+// subscribers can resume with Last-Event-ID, connection events carry none.
+type event struct {
+	id   uint64
+	name string
+	data []byte
+}
+
+func (e event) writeTo(w http.ResponseWriter) error {
+	if e.id != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", e.id); err != nil {
+			return err
+		}
+	}
+
+	if e.name != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", e.name); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "data: %s\n\n", e.data)
+
+	return err
+}
+
+// connectionEvent returns the event announcing the upstream connection state.
+func connectionEvent(connected bool) event {
+	name := eventDisconnected
+	if connected {
+		name = eventConnected
+	}
+
+	return event{name: name, data: []byte(`{"connected":` + strconv.FormatBool(connected) + `}`)}
+}
+
+// reconnectingEvent is the data of the event announcing an attempt to
+// reconnect to the Signal API.
+type reconnectingEvent struct {
+	Attempt int    `json:"attempt"`
+	Delay   string `json:"delay"`
+	Error   string `json:"error,omitempty"`
+}
+
+// broker fans the events out to the subscribers of the events route.
+type broker struct {
+	mu          sync.Mutex
+	subscribers map[chan event]struct{}
+	connected   *bool
+}
+
+func newBroker() *broker {
+	return &broker{subscribers: make(map[chan event]struct{})}
+}
+
+// subscribe returns a channel receiving the events, and the current connection
+// state if it is known. The channel is closed if the subscriber falls behind.
+func (b *broker) subscribe() (chan event, *bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan event, eventsBuffer)
+	b.subscribers[ch] = struct{}{}
+
+	return ch, b.connected
+}
+
+func (b *broker) unsubscribe(ch chan event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *broker) publish(e event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.publishLocked(e)
+}
+
+// setConnected records the upstream connection state and publishes it if it
+// changed.
+func (b *broker) setConnected(connected bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.connected != nil && *b.connected == connected {
+		return
+	}
+
+	b.connected = &connected
+	b.publishLocked(connectionEvent(connected))
+}
+
+func (b *broker) publishLocked(e event) {
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Handle implements the notifier handler for the default account.
+func (s *Server) Handle(ctx context.Context, payload receiver.NotifierPayload) error {
+	return s.defaultAccount.Handle(ctx, payload)
+}
+
+// Handle implements the notifier handler, it streams the remote deletes and
+// edits, the changes of the upstream connection state and the attempts to
+// reconnect to the events subscribers of the account. The recorded messages
+// are streamed from the receiver, in order, by receiveEvents.
+func (a *Account) Handle(_ context.Context, payload receiver.NotifierPayload) error {
+	// the handlers of the payloads run concurrently, the state of the payload
+	// may be stale by now so the current state is published instead.
+	if payload.IsConnected != nil {
+		a.events.setConnected(a.sarc.Connected())
+	}
+
+	if payload.Reconnect != nil {
+		e := reconnectingEvent{Attempt: payload.Reconnect.Attempt, Delay: payload.Reconnect.Delay.String()}
+		if payload.Reconnect.Err != nil {
+			e.Error = payload.Reconnect.Err.Error()
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("error marshaling the reconnect attempt: %w", err)
+		}
+
+		a.events.publish(event{name: eventReconnecting, data: data})
+	}
+
+	if err := a.publishRemoteChange(eventDeleted, payload.Deleted); err != nil {
+		return err
+	}
+
+	return a.publishRemoteChange(eventEdited, payload.Edited)
+}
+
+// publishRemoteChange publishes the remote delete or edit, if set, as the named
+// event.
+func (a *Account) publishRemoteChange(name string, m *receiver.Message) error {
+	if m == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshaling the %s message: %w", name, err)
+	}
+
+	a.events.publish(event{name: name, data: data})
+
+	return nil
+}
+
+// receiveEvents streams the recorded messages as Server-Sent Events. The
+// messages recorded after Last-Event-ID are replayed first if it is set. A
+// Last-Event-ID beyond the last recorded message comes from before the queue
+// was reset, all the messages still in the queue are replayed then.
+func (s *Server) receiveEvents(w http.ResponseWriter, r *http.Request) {
+	var lastID uint64
+
+	replay := false
+
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Last-Event-ID must be a message ID", http.StatusBadRequest)
+
+			return
+		}
+
+		lastID = id
+		replay = true
+	}
+
+	a := s.requestAccount(r)
+
+	// subscribe before replaying so no message falls in between.
+	msgs, stopMessages := a.sarc.SubscribeMessages()
+	defer stopMessages()
+
+	ch, connected := a.events.subscribe()
+	defer a.events.unsubscribe(ch)
+
+	switch last := a.sarc.LastID(); {
+	case !replay:
+		// only the messages recorded from now on are streamed.
+		lastID = last
+	case lastID > last:
+		// the Last-Event-ID comes from before the queue was reset.
+		lastID = 0
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set(contentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// flush the headers, the first event may take a while.
+	if rc.Flush() != nil {
+		return
+	}
+
+	send := func(e event) bool {
+		if err := e.writeTo(w); err != nil {
+			return false
+		}
+
+		return rc.Flush() == nil
+	}
+
+	sendMessage := func(msg receiver.Message) bool {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("error marshaling the message")
+
+			return false
+		}
+
+		lastID = msg.ID
+
+		return send(event{id: msg.ID, data: data})
+	}
+
+	if connected != nil && !send(connectionEvent(*connected)) {
+		return
+	}
+
+	if replay {
+		for {
+			replayed := a.sarc.Since(lastID, maxLimit)
+			if len(replayed) == 0 {
+				break
+			}
+
+			for _, msg := range replayed {
+				if !sendMessage(msg) {
+					return
+				}
+			}
+		}
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+
+			// skip the messages that were already replayed.
+			if msg.ID <= lastID {
+				continue
+			}
+
+			if !sendMessage(msg) {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			if !send(e) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		case <-s.draining:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/receiver"
+	"github.com/kalbasit/signal-api-receiver/pkg/server"
+)
+
+// subscribe opens the events stream and returns a function reading the next
+// event, as its lines without the trailing blank line.
+func subscribe(t *testing.T, url, lastEventID string) func() []string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/receive/events", nil)
+	require.NoError(t, err)
+
+	if lastEventID != "" {
+		r.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { resp.Body.Close() })
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(resp.Body)
+
+	return func() []string {
+		t.Helper()
+
+		var lines []string
+
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				return lines
+			}
+
+			lines = append(lines, line)
+		}
+
+		require.NoError(t, scanner.Err())
+
+		return lines
+	}
+}
+
+func TestReceiveEvents(t *testing.T) {
+	t.Parallel()
+
+	t.Run("streams the recorded messages and the connection changes", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t, receiver.Message{Account: "old"})
+		s := server.New(newContext(), sc, false)
+
+		hs := httptest.NewServer(s)
+		t.Cleanup(hs.Close)
+
+		require.NoError(t, s.Handle(context.Background(), receiver.PrepareNotifierPayload(nil, true)))
+
+		next := subscribe(t, hs.URL, "")
+
+		// the current connection state is sent first.
+		assert.Equal(t, []string{"event: connected", `data: {"connected":true}`}, next())
+
+		// only the messages recorded from now on are streamed.
+		sc.record(t, receiver.Message{Account: "0"})
+
+		got := next()
+		require.Len(t, got, 2)
+		assert.Equal(t, "id: 2", got[0])
+		assert.True(t, strings.HasPrefix(got[1], `data: {"id":2,"account":"0"`), got[1])
+
+		sc.disconnected.Store(true)
+		require.NoError(t, s.Handle(context.Background(), receiver.PrepareNotifierPayload(nil, false)))
+		require.NoError(t, s.Handle(context.Background(), receiver.PrepareNotifierPayload(nil, false)))
+		assert.Equal(t, []string{"event: disconnected", `data: {"connected":false}`}, next())
+
+		sc.disconnected.Store(false)
+		require.NoError(t, s.Handle(context.Background(), receiver.PrepareNotifierPayload(nil, true)))
+		assert.Equal(t, []string{"event: connected", `data: {"connected":true}`}, next())
+	})
+
+	t.Run("a stale payload does not change the connection state", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t)
+		s := server.New(newContext(), sc, false)
+
+		hs := httptest.NewServer(s)
+		t.Cleanup(hs.Close)
+
+		require.NoError(t, s.Handle(context.Background(), receiver.PrepareNotifierPayload(nil, true)))
+
+		next := subscribe(t, hs.URL, "")
+		assert.Equal(t, []string{"event: connected", `data: {"connected":true}`}, next())
+
+		// the receiver reconnected before the payload was handled.
+		require.NoError(t, s.Handle(context.Background(), receiver.PrepareNotifierPayload(nil, false)))
+
+		sc.record(t, receiver.Message{Account: "0"})
+
+		got := next()
+		require.Len(t, got, 2)
+		assert.Equal(t, "id: 1", got[0])
+	})
+
+	t.Run("streams the attempts to reconnect", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t)
+		s := server.New(newContext(), sc, false)
+
+		hs := httptest.NewServer(s)
+		t.Cleanup(hs.Close)
+
+		require.NoError(t, s.Handle(context.Background(), receiver.PrepareNotifierPayload(nil, true)))
+
+		next := subscribe(t, hs.URL, "")
+		assert.Equal(t, []string{"event: connected", `data: {"connected":true}`}, next())
+
+		sc.disconnected.Store(true)
+
+		payload := receiver.PrepareNotifierPayload(nil, false)
+		payload.Reconnect = &receiver.ReconnectAttempt{Attempt: 2, Delay: 2 * time.Second, Err: io.ErrUnexpectedEOF}
+
+		require.NoError(t, s.Handle(context.Background(), payload))
+
+		assert.Equal(t, []string{"event: disconnected", `data: {"connected":false}`}, next())
+		assert.Equal(t, []string{
+			"event: reconnecting",
+			`data: {"attempt":2,"delay":"2s","error":"unexpected EOF"}`,
+		}, next())
+	})
+
+	t.Run("streams the remote deletes and edits", func(t *testing.T) {
+		t.Parallel()
+
+		s := server.New(newContext(), newStoreClient(t), false)
+
+		hs := httptest.NewServer(s)
+		t.Cleanup(hs.Close)
+
+		next := subscribe(t, hs.URL, "")
+
+		payload := receiver.PrepareNotifierPayload(nil, true)
+		payload.Deleted = &receiver.Message{Account: "0"}
+
+		require.NoError(t, s.Handle(context.Background(), payload))
+		assert.Equal(t, []string{"event: connected", `data: {"connected":true}`}, next())
+
+		got := next()
+		require.Len(t, got, 2)
+		assert.Equal(t, "event: deleted", got[0])
+		assert.True(t, strings.HasPrefix(got[1], `data: {"account":"0"`), got[1])
+
+		payload = receiver.PrepareNotifierPayload(nil, true)
+		payload.Edited = &receiver.Message{Account: "1"}
+
+		require.NoError(t, s.Handle(context.Background(), payload))
+
+		got = next()
+		require.Len(t, got, 2)
+		assert.Equal(t, "event: edited", got[0])
+		assert.True(t, strings.HasPrefix(got[1], `data: {"account":"1"`), got[1])
+	})
+
+	t.Run("replays the messages recorded after Last-Event-ID", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t, receiver.Message{Account: "0"}, receiver.Message{Account: "1"})
+
+		s := server.New(newContext(), sc, false)
+
+		hs := httptest.NewServer(s)
+		t.Cleanup(hs.Close)
+
+		require.NoError(t, s.Handle(context.Background(), receiver.PrepareNotifierPayload(nil, true)))
+
+		next := subscribe(t, hs.URL, "1")
+
+		assert.Equal(t, []string{"event: connected", `data: {"connected":true}`}, next())
+
+		got := next()
+		require.Len(t, got, 2)
+		assert.Equal(t, "id: 2", got[0])
+
+		sc.record(t, receiver.Message{Account: "2"})
+
+		got = next()
+		require.Len(t, got, 2)
+		assert.Equal(t, "id: 3", got[0])
+	})
+
+	t.Run("a Last-Event-ID beyond the last message replays the queue", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t, receiver.Message{Account: "0"}, receiver.Message{Account: "1"})
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false))
+		t.Cleanup(hs.Close)
+
+		// the queue was reset since the subscriber received the message 42.
+		next := subscribe(t, hs.URL, "42")
+
+		for _, id := range []string{"id: 1", "id: 2"} {
+			got := next()
+			require.Len(t, got, 2)
+			assert.Equal(t, id, got[0])
+		}
+	})
+
+	t.Run("an invalid Last-Event-ID is rejected", func(t *testing.T) {
+		t.Parallel()
+
+		hs := httptest.NewServer(server.New(newContext(), newStoreClient(t), false))
+		defer hs.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, hs.URL+"/receive/events", nil)
+		require.NoError(t, err)
+
+		r.Header.Set("Last-Event-ID", "abc")
+
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
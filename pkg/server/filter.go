@@ -0,0 +1,54 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/receiver"
+)
+
+var errInvalidFilter = errors.New("invalid filter")
+
+// filterParam returns the filter set with the query parameters of the pop and
+// flush routes.
+func filterParam(r *http.Request) (receiver.Filter, error) {
+	q := r.URL.Query()
+
+	filter := receiver.Filter{
+		Source:     q.Get("source"),
+		SourceUUID: q.Get("sourceUuid"),
+		GroupID:    q.Get("groupId"),
+	}
+
+	for _, v := range q["type"] {
+		mt, err := receiver.ParseMessageType(v)
+		if err != nil {
+			return receiver.Filter{}, fmt.Errorf("%w: type %q: %w", errInvalidFilter, v, err)
+		}
+
+		filter.Types = append(filter.Types, mt)
+	}
+
+	if v := q.Get("text~"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return receiver.Filter{}, fmt.Errorf("%w: text~ %q: %w", errInvalidFilter, v, err)
+		}
+
+		filter.Text = re
+	}
+
+	if v := q.Get("hasAttachment"); v != "" {
+		hasAttachment, err := strconv.ParseBool(v)
+		if err != nil {
+			return receiver.Filter{}, fmt.Errorf("%w: hasAttachment %q: %w", errInvalidFilter, v, err)
+		}
+
+		filter.HasAttachment = &hasAttachment
+	}
+
+	return filter, nil
+}
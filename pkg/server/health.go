@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	routeReadyz = "/readyz"
+	routeStatus = "/status"
+
+	checkPass = "pass"
+	checkFail = "fail"
+)
+
+var (
+	errSignalAPIDisconnected = errors.New("the websocket to the Signal API is disconnected")
+	errStaleFrames           = errors.New("no frame was received from the Signal API for too long")
+)
+
+// Check is a health check of a dependency, reported on /readyz and /status.
+type Check struct {
+	// Name identifies the check in the responses.
+	Name string
+
+	// Required checks make the server not ready when they fail, and the
+	// responses are then 503 Service Unavailable.
+	Required bool
+
+	// Run returns the details of the dependency reported on /status, and an
+	// error if it is not healthy.
+	Run func() (map[string]any, error)
+}
+
+// WithCheck adds a health check reported on /readyz and /status, along with the
+// checks of the connection to the Signal API.
+func WithCheck(check Check) Option {
+	return func(s *Server) { s.checks = append(s.checks, check) }
+}
+
+// WithMaxFrameAge fails the last-frame check if no frame was received from the
+// Signal API for longer than maxAge. The check only reports the time since the
+// last frame if maxAge is not positive.
+func WithMaxFrameAge(maxAge time.Duration) Option {
+	return func(s *Server) { s.maxFrameAge = maxAge }
+}
+
+// checkResult is the outcome of a check. Details are only set on /status.
+type checkResult struct {
+	Status   string         `json:"status"`
+	Required bool           `json:"required"`
+	Error    string         `json:"error,omitempty"`
+	Details  map[string]any `json:"details,omitempty"`
+}
+
+// healthResponse is returned by /readyz and /status. Status fails if any of the
+// required checks fails.
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// accountChecks returns the checks of the connections to the Signal API. The
+// checks of the accounts other than the default one have the account in their
+// names, e.g. signal-api/+15551234567.
+func (s *Server) accountChecks() []Check {
+	checks := []Check{
+		signalAPICheck("signal-api", s.defaultAccount.sarc),
+		s.lastFrameCheck("last-frame", s.defaultAccount.sarc),
+	}
+
+	names := slices.Sorted(maps.Keys(s.accounts))
+	for _, name := range names {
+		if a := s.accounts[name]; a != s.defaultAccount {
+			checks = append(checks,
+				signalAPICheck("signal-api/"+name, a.sarc),
+				s.lastFrameCheck("last-frame/"+name, a.sarc),
+			)
+		}
+	}
+
+	return checks
+}
+
+// signalAPICheck checks that the websocket to the Signal API is connected.
+func signalAPICheck(name string, sarc client) Check {
+	return Check{
+		Name:     name,
+		Required: true,
+		Run: func() (map[string]any, error) {
+			connected := sarc.Connected()
+			details := map[string]any{"connected": connected}
+
+			if !connected {
+				return details, errSignalAPIDisconnected
+			}
+
+			return details, nil
+		},
+	}
+}
+
+// lastFrameCheck reports the time since the last frame was received from the
+// Signal API, or since the server started if none was received yet.
+func (s *Server) lastFrameCheck(name string, sarc client) Check {
+	return Check{
+		Name:     name,
+		Required: true,
+		Run: func() (map[string]any, error) {
+			details := make(map[string]any)
+
+			since := s.startedAt
+			if lastFrame := sarc.LastFrame(); !lastFrame.IsZero() {
+				since = lastFrame
+				details["lastFrameAt"] = lastFrame.UTC().Format(time.RFC3339Nano)
+			}
+
+			age := time.Since(since)
+			details["secondsSinceLastFrame"] = age.Seconds()
+
+			if s.maxFrameAge > 0 {
+				details["maxSeconds"] = s.maxFrameAge.Seconds()
+
+				if age > s.maxFrameAge {
+					return details, errStaleFrames
+				}
+			}
+
+			return details, nil
+		},
+	}
+}
+
+// health runs the checks, and returns their details if withDetails is set.
+func (s *Server) health(withDetails bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		resp := healthResponse{
+			Status: checkPass,
+			Checks: make(map[string]checkResult, len(s.checks)),
+		}
+
+		for _, check := range s.checks {
+			details, err := check.Run()
+
+			result := checkResult{Status: checkPass, Required: check.Required}
+			if withDetails {
+				result.Details = details
+			}
+
+			if err != nil {
+				result.Status = checkFail
+				result.Error = err.Error()
+
+				if check.Required {
+					resp.Status = checkFail
+				}
+			}
+
+			resp.Checks[check.Name] = result
+		}
+
+		w.Header().Set(contentType, contentTypeJSON)
+
+		if resp.Status != checkPass {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
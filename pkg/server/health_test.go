@@ -0,0 +1,141 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/server"
+)
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Checks map[string]struct {
+		Status   string         `json:"status"`
+		Required bool           `json:"required"`
+		Error    string         `json:"error"`
+		Details  map[string]any `json:"details"`
+	} `json:"checks"`
+}
+
+func getHealth(t *testing.T, url string) (int, healthResponse) {
+	t.Helper()
+
+	//nolint:noctx
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var got healthResponse
+
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+
+	return resp.StatusCode, got
+}
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+
+	errBrokerDown := errors.New("the connection to the broker is down") //nolint:err113
+
+	t.Run("ready while the required checks pass", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t)
+		sc.lastFrame.Store(time.Now().Add(-time.Minute).UnixNano())
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false,
+			server.WithMaxFrameAge(time.Hour),
+			server.WithCheck(server.Check{
+				Name: "mqtt",
+				Run:  func() (map[string]any, error) { return map[string]any{"connected": false}, errBrokerDown },
+			}),
+		))
+		defer hs.Close()
+
+		code, got := getHealth(t, hs.URL+"/readyz")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "pass", got.Status)
+		assert.Equal(t, "pass", got.Checks["signal-api"].Status)
+		assert.True(t, got.Checks["signal-api"].Required)
+		assert.Equal(t, "pass", got.Checks["last-frame"].Status)
+
+		// a check that is not required fails without making the server unready.
+		assert.Equal(t, "fail", got.Checks["mqtt"].Status)
+		assert.False(t, got.Checks["mqtt"].Required)
+		assert.Equal(t, errBrokerDown.Error(), got.Checks["mqtt"].Error)
+
+		// the details are only returned on /status.
+		assert.Nil(t, got.Checks["signal-api"].Details)
+
+		code, got = getHealth(t, hs.URL+"/status")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, map[string]any{"connected": true}, got.Checks["signal-api"].Details)
+		assert.Equal(t, map[string]any{"connected": false}, got.Checks["mqtt"].Details)
+		assert.Contains(t, got.Checks["last-frame"].Details, "lastFrameAt")
+		assert.InDelta(t, 60, got.Checks["last-frame"].Details["secondsSinceLastFrame"], 5)
+		assert.InDelta(t, 3600, got.Checks["last-frame"].Details["maxSeconds"], 0)
+	})
+
+	t.Run("not ready while the Signal API is disconnected", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t)
+		sc.disconnected.Store(true)
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false))
+		defer hs.Close()
+
+		for _, route := range []string{"/readyz", "/status"} {
+			code, got := getHealth(t, hs.URL+route)
+			assert.Equal(t, http.StatusServiceUnavailable, code, route)
+			assert.Equal(t, "fail", got.Status, route)
+			assert.Equal(t, "fail", got.Checks["signal-api"].Status, route)
+			assert.NotEmpty(t, got.Checks["signal-api"].Error, route)
+		}
+	})
+
+	t.Run("not ready when the last frame is too old", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t)
+		sc.lastFrame.Store(time.Now().Add(-time.Hour).UnixNano())
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false,
+			server.WithMaxFrameAge(time.Minute),
+			server.WithCheck(server.Check{
+				Name:     "mqtt",
+				Required: true,
+				Run:      func() (map[string]any, error) { return nil, nil },
+			}),
+		))
+		defer hs.Close()
+
+		code, got := getHealth(t, hs.URL+"/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "fail", got.Checks["last-frame"].Status)
+		assert.Equal(t, "pass", got.Checks["mqtt"].Status)
+	})
+
+	t.Run("without a maximum age the last frame is only reported", func(t *testing.T) {
+		t.Parallel()
+
+		hs := httptest.NewServer(server.New(newContext(), newStoreClient(t), false))
+		defer hs.Close()
+
+		code, got := getHealth(t, hs.URL+"/status")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "pass", got.Checks["last-frame"].Status)
+		assert.NotContains(t, got.Checks["last-frame"].Details, "lastFrameAt")
+		assert.Contains(t, got.Checks["last-frame"].Details, "secondsSinceLastFrame")
+	})
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const routeMetrics = "/metrics"
+
+//nolint:gochecknoglobals
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "signal_receiver_http_request_duration_seconds",
+	Help:    "The time taken to serve the HTTP requests, by method, route and status code.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "route", "code"})
+
+// requestMetrics records the time taken to serve each request. Requests are
+// labelled with the pattern of the route that served them, not their path, so
+// the consumers do not each get a series.
+func requestMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startedAt := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			requestDuration.
+				WithLabelValues(r.Method, route, strconv.Itoa(ww.Status())).
+				Observe(time.Since(startedAt).Seconds())
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -0,0 +1,46 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/server"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	sc := newStoreClient(t)
+	require.NoError(t, sc.store.AddConsumer("metrics-test"))
+
+	hs := httptest.NewServer(server.New(newContext(), sc, false))
+	defer hs.Close()
+
+	//nolint:noctx
+	resp, err := http.Get(hs.URL + "/receive/metrics-test/pop")
+	require.NoError(t, err)
+
+	resp.Body.Close()
+
+	//nolint:noctx
+	resp, err = http.Get(hs.URL + "/metrics")
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain; version=0.0.4")
+
+	// the requests are labelled with the route pattern, not the consumer.
+	assert.Contains(t, string(body),
+		`signal_receiver_http_request_duration_seconds_count{code="200",method="GET",route="/receive/{consumer}/pop"}`)
+	assert.NotContains(t, string(body), "metrics-test")
+}
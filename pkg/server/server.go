@@ -3,54 +3,152 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"sync/atomic"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 
 	"github.com/kalbasit/signal-api-receiver/pkg/receiver"
 )
 
 const (
-	routeReceiveFlush = "/receive/flush"
-	routeReceivePop   = "/receive/pop"
+	routeReceiveFlush         = "/receive/flush"
+	routeReceivePop           = "/receive/pop"
+	routeReceiveConsumerFlush = "/receive/{consumer}/flush"
+	routeReceiveConsumerPop   = "/receive/{consumer}/pop"
+	routeReceiveLease         = "/receive/lease"
+	routeReceiveConsumerLease = "/receive/{consumer}/lease"
+	routeReceiveAck           = "/receive/ack/{handle}"
+	routeConsumer             = "/consumers/{consumer}"
+	routeReceiveSince         = "/receive/since"
+	routeReceivePeek          = "/receive/peek"
+	routeReceiveConsumerPeek  = "/receive/{consumer}/peek"
+	routeReceiveCount         = "/receive/count"
+	routeReceiveConsumerCount = "/receive/{consumer}/count"
+
+	// defaultLeaseTimeout is the visibility timeout of a lease that does not
+	// set one.
+	defaultLeaseTimeout = 30 * time.Second
+
+	// maxLeaseTimeout is the longest visibility timeout a lease may set.
+	maxLeaseTimeout = 12 * time.Hour
+
+	// maxWait is the longest a long-polling request waits for a message.
+	maxWait = 5 * time.Minute
+
+	// defaultLimit and maxLimit bound the number of messages returned by the
+	// since and peek routes.
+	defaultLimit = 100
+	maxLimit     = 1000
 
 	contentType     = "Content-Type"
 	contentTypeJSON = "application/json"
 )
 
+var (
+	errInvalidWait  = errors.New("wait must be a positive duration of at most " + maxWait.String())
+	errInvalidLimit = errors.New("limit must be a positive number")
+)
+
 // Server represent the HTTP server that exposes the pop/flush routes.
 type Server struct {
 	logger zerolog.Logger
 
 	router *chi.Mux
 
-	sarc       client
 	repeatLast bool
-	last       atomic.Pointer[receiver.Message]
+
+	// defaultAccount is served by the routes that are not scoped to an
+	// account, accounts by the scoped routes.
+	defaultAccount *Account
+	accounts       map[string]*Account
+
+	// apiKeys are the keys accepted by the server, authentication is disabled
+	// if there are none.
+	apiKeys APIKeys
+
+	// draining is closed by Drain to end the long-polls and the streams.
+	drainOnce sync.Once
+	draining  chan struct{}
+
+	// checks are reported on /readyz and /status.
+	checks      []Check
+	maxFrameAge time.Duration
+	startedAt   time.Time
+}
+
+// Option configures the Server returned by New.
+type Option func(*Server)
+
+// WithAPIKeys requires every request to carry one of the API keys, either as a
+// bearer token or with the X-API-Key header.
+func WithAPIKeys(keys APIKeys) Option {
+	return func(s *Server) { s.apiKeys = keys }
 }
 
 type client interface {
-	Connect(ctx context.Context) error
-	ReceiveLoop(ctx context.Context) error
-	Pop() *receiver.Message
-	Flush() []receiver.Message
+	Pop(consumer string, filter receiver.Filter) *receiver.Message
+	Flush(consumer string, filter receiver.Filter) []receiver.Message
+	Lease(consumer string, timeout time.Duration) (*receiver.Message, string)
+	Ack(handle string) error
+	HasConsumer(name string) bool
+	RemoveConsumer(name string) error
+	Since(cursor uint64, limit int) []receiver.Message
+	Peek(consumer string, limit int) []receiver.Message
+	Count(consumer string) (int, map[receiver.MessageType]int)
+	Recorded() <-chan struct{}
+	SubscribeFrames() (<-chan receiver.Frame, func())
+	SubscribeMessages() (<-chan receiver.Message, func())
+	LastID() uint64
+	Connected() bool
+	LastFrame() time.Time
+}
+
+// sinceResponse is returned by the since route. Cursor is the ID of the last
+// returned message, or the requested cursor if no message was returned.
+type sinceResponse struct {
+	Messages []receiver.Message `json:"messages"`
+	Cursor   uint64             `json:"cursor"`
+}
+
+// countResponse is returned by the count routes. Types is only set if the
+// count was broken down by message type.
+type countResponse struct {
+	Count int            `json:"count"`
+	Types map[string]int `json:"types,omitempty"`
+}
+
+// leaseResponse is returned by the lease routes, it is an empty object if no
+// message was found.
+type leaseResponse struct {
+	Handle  string            `json:"handle,omitempty"`
+	Message *receiver.Message `json:"message,omitempty"`
 }
 
 // New returns a new Server.
-func New(ctx context.Context, sarc client, repeatLastMessage bool) *Server {
+func New(ctx context.Context, sarc client, repeatLastMessage bool, opts ...Option) *Server {
 	s := &Server{
-		logger:     *zerolog.Ctx(ctx),
-		sarc:       sarc,
-		repeatLast: repeatLastMessage,
+		logger:         *zerolog.Ctx(ctx),
+		repeatLast:     repeatLastMessage,
+		defaultAccount: newAccount(sarc),
+		accounts:       make(map[string]*Account),
+		startedAt:      time.Now(),
+		draining:       make(chan struct{}),
 	}
 
-	s.createRouter()
+	for _, opt := range opts {
+		opt(s)
+	}
 
-	go s.start(ctx)
+	s.checks = append(s.accountChecks(), s.checks...)
+
+	s.createRouter()
 
 	return s
 }
@@ -58,44 +156,190 @@ func New(ctx context.Context, sarc client, repeatLastMessage bool) *Server {
 // ServeHTTP implements http.Handler and turns the Server type into a handler.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) { s.router.ServeHTTP(w, r) }
 
-func (s *Server) start(ctx context.Context) {
-	log := s.logger.With().Str("func", "start").Logger()
+// Drain ends the long-polling requests, with the messages recorded so far, and
+// the event and websocket streams so a graceful shutdown of the HTTP server
+// does not wait for them. It is meant to be registered with
+// http.Server.RegisterOnShutdown.
+func (s *Server) Drain() {
+	s.drainOnce.Do(func() { close(s.draining) })
+}
+
+func (s *Server) createRouter() {
+	s.router = chi.NewRouter()
+
+	if len(s.apiKeys) > 0 {
+		// every API key grants the read scope, which covers the health check.
+		s.router.Use(middleware.RequestID)
+		s.router.Use(middleware.RealIP)
+		s.router.Use(s.authenticate)
+		s.router.Use(middleware.Heartbeat("/healthz"))
+	} else {
+		s.router.Use(middleware.Heartbeat("/healthz"))
+		s.router.Use(middleware.RequestID)
+		s.router.Use(middleware.RealIP)
+	}
+
+	s.router.Use(requestLogger(s.logger))
+	s.router.Use(requestMetrics)
+	s.router.Use(middleware.Recoverer)
+
+	s.router.Get(routeReceiveWebsocket, s.receiveWebsocket)
+	s.router.Method(http.MethodGet, routeMetrics, promhttp.Handler())
+	s.router.Get(routeReadyz, s.health(false))
+	s.router.Get(routeStatus, s.health(true))
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.resolveAccount)
+
+		s.accountRoutes(r, func(route string) string { return route })
+		s.accountRoutes(r, accountRoute)
+	})
+}
+
+// accountRoutes registers the routes serving the messages of an account, at the
+// patterns returned by route.
+func (s *Server) accountRoutes(r chi.Router, route func(string) string) {
+	// the routes that do not consume messages only need the read scope.
+	r.Get(route(routeReceiveSince), s.receiveSince)
+	r.Get(route(routeReceivePeek), s.receivePeek)
+	r.Get(route(routeReceiveConsumerPeek), s.receivePeek)
+	r.Get(route(routeReceiveCount), s.receiveCount)
+	r.Get(route(routeReceiveConsumerCount), s.receiveCount)
+	r.Get(route(routeReceiveEvents), s.receiveEvents)
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.requireScope(ScopeConsume))
+
+		r.Get(route(routeReceiveFlush), s.receiveFlush)
+		r.Get(route(routeReceivePop), s.receivePop)
+		r.Get(route(routeReceiveConsumerFlush), s.receiveFlush)
+		r.Get(route(routeReceiveConsumerPop), s.receivePop)
+		r.Post(route(routeReceiveLease), s.receiveLease)
+		r.Post(route(routeReceiveConsumerLease), s.receiveLease)
+		r.Post(route(routeReceiveAck), s.receiveAck)
+		r.Delete(route(routeConsumer), s.removeConsumer)
+	})
+}
+
+// consumerParam returns the consumer named in the route, or the default consumer
+// for the routes that are not scoped to a consumer.
+func consumerParam(r *http.Request) (string, error) {
+	name := chi.URLParam(r, "consumer")
+	if name == "" {
+		return receiver.DefaultConsumer, nil
+	}
+
+	return name, receiver.ValidateConsumer(name)
+}
+
+// requestConsumer returns the consumer of the request. It writes a 400 response
+// if the name is not valid and a 404 response if the consumer does not exist,
+// and reports whether the request may proceed.
+func requestConsumer(w http.ResponseWriter, r *http.Request, a *Account) (string, bool) {
+	consumer, err := consumerParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return "", false
+	}
+
+	if !a.sarc.HasConsumer(consumer) {
+		http.Error(w, receiver.ErrConsumerNotFound.Error(), http.StatusNotFound)
+
+		return "", false
+	}
+
+	return consumer, true
+}
+
+// waitParam returns how long the request waits for a message if none is
+// queued, zero if it does not long-poll.
+func waitParam(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("wait")
+	if v == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(v)
+	if err != nil || wait <= 0 || wait > maxWait {
+		return 0, errInvalidWait
+	}
+
+	return wait, nil
+}
+
+// await calls receive until it reports that it received messages, waiting for
+// new messages to be recorded in between for up to wait. An error is returned
+// if the request is canceled, e.g. because the client went away.
+func (s *Server) await(ctx context.Context, a *Account, wait time.Duration, receive func() bool) error {
+	if wait <= 0 {
+		receive()
+
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
 
 	for {
-		if err := s.sarc.ReceiveLoop(ctx); err != nil {
-			log.Error().Err(err).Msg("error in the receive loop")
-		}
+		recorded := a.sarc.Recorded()
 
-	Reconnect:
-		if err := s.sarc.Connect(ctx); err != nil {
-			log.Error().Err(err).Msg("Error reconnecting: %v")
-			time.Sleep(time.Second)
+		if receive() {
+			return nil
+		}
 
-			goto Reconnect
+		select {
+		case <-recorded:
+		case <-timer.C:
+			return nil
+		case <-s.draining:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
 
-func (s *Server) createRouter() {
-	s.router = chi.NewRouter()
+func (s *Server) receivePop(w http.ResponseWriter, r *http.Request) {
+	a := s.requestAccount(r)
 
-	s.router.Use(middleware.Heartbeat("/healthz"))
-	s.router.Use(middleware.RequestID)
-	s.router.Use(middleware.RealIP)
-	s.router.Use(requestLogger(s.logger))
-	s.router.Use(middleware.Recoverer)
+	consumer, ok := requestConsumer(w, r, a)
+	if !ok {
+		return
+	}
 
-	s.router.Get(routeReceiveFlush, s.receiveFlush)
-	s.router.Get(routeReceivePop, s.receivePop)
-}
+	wait, err := waitParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	filter, err := filterParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	var msg *receiver.Message
+
+	if err := s.await(r.Context(), a, wait, func() bool {
+		msg = a.sarc.Pop(consumer, filter)
+
+		return msg != nil
+	}); err != nil {
+		return
+	}
 
-func (s *Server) receivePop(w http.ResponseWriter, _ *http.Request) {
-	msg := s.sarc.Pop()
 	if s.repeatLast {
 		if msg == nil {
-			msg = s.last.Load()
+			// only repeat the last message if it matches the filter.
+			if last := a.lastMessage(consumer); last != nil && filter.Match(*last) {
+				msg = last
+			}
 		} else {
-			s.last.Store(msg)
+			a.storeLast(consumer, []receiver.Message{*msg})
 		}
 	}
 
@@ -112,10 +356,40 @@ func (s *Server) receivePop(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
-func (s *Server) receiveFlush(w http.ResponseWriter, _ *http.Request) {
-	msgs := s.sarc.Flush()
-	if s.repeatLast && len(msgs) > 0 {
-		s.last.Store(&msgs[len(msgs)-1])
+func (s *Server) receiveFlush(w http.ResponseWriter, r *http.Request) {
+	a := s.requestAccount(r)
+
+	consumer, ok := requestConsumer(w, r, a)
+	if !ok {
+		return
+	}
+
+	wait, err := waitParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	filter, err := filterParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	var msgs []receiver.Message
+
+	if err := s.await(r.Context(), a, wait, func() bool {
+		msgs = a.sarc.Flush(consumer, filter)
+
+		return len(msgs) > 0
+	}); err != nil {
+		return
+	}
+
+	if s.repeatLast {
+		a.storeLast(consumer, msgs)
 	}
 
 	w.Header().Set(contentType, contentTypeJSON)
@@ -125,6 +399,201 @@ func (s *Server) receiveFlush(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+func (s *Server) receiveLease(w http.ResponseWriter, r *http.Request) {
+	a := s.requestAccount(r)
+
+	consumer, ok := requestConsumer(w, r, a)
+	if !ok {
+		return
+	}
+
+	timeout := defaultLeaseTimeout
+
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		var err error
+
+		timeout, err = time.ParseDuration(v)
+		if err != nil || timeout <= 0 || timeout > maxLeaseTimeout {
+			http.Error(w, "timeout must be a positive duration of at most "+maxLeaseTimeout.String(),
+				http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	var resp leaseResponse
+
+	resp.Message, resp.Handle = a.sarc.Lease(consumer, timeout)
+
+	w.Header().Set(contentType, contentTypeJSON)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) receiveAck(w http.ResponseWriter, r *http.Request) {
+	a := s.requestAccount(r)
+
+	err := a.sarc.Ack(chi.URLParam(r, "handle"))
+
+	switch {
+	case errors.Is(err, receiver.ErrLeaseNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// limitParam returns the number of messages to return, defaultLimit if the
+// request does not set one. It is capped to maxLimit.
+func limitParam(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 {
+		return 0, errInvalidLimit
+	}
+
+	return min(limit, maxLimit), nil
+}
+
+func (s *Server) receiveSince(w http.ResponseWriter, r *http.Request) {
+	a := s.requestAccount(r)
+
+	var cursor uint64
+
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		var err error
+
+		cursor, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "cursor must be a message ID", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	limit, err := limitParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	resp := sinceResponse{
+		Messages: a.sarc.Since(cursor, limit),
+		Cursor:   cursor,
+	}
+
+	if len(resp.Messages) > 0 {
+		resp.Cursor = resp.Messages[len(resp.Messages)-1].ID
+	} else {
+		resp.Messages = []receiver.Message{}
+	}
+
+	w.Header().Set(contentType, contentTypeJSON)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) receivePeek(w http.ResponseWriter, r *http.Request) {
+	a := s.requestAccount(r)
+
+	consumer, ok := requestConsumer(w, r, a)
+	if !ok {
+		return
+	}
+
+	limit, err := limitParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	msgs := a.sarc.Peek(consumer, limit)
+	if msgs == nil {
+		msgs = []receiver.Message{}
+	}
+
+	w.Header().Set(contentType, contentTypeJSON)
+
+	if err := json.NewEncoder(w).Encode(msgs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) receiveCount(w http.ResponseWriter, r *http.Request) {
+	a := s.requestAccount(r)
+
+	consumer, ok := requestConsumer(w, r, a)
+	if !ok {
+		return
+	}
+
+	var byType bool
+
+	if v := r.URL.Query().Get("byType"); v != "" {
+		var err error
+
+		byType, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "byType must be true or false", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	count, types := a.sarc.Count(consumer)
+
+	resp := countResponse{Count: count}
+
+	if byType {
+		resp.Types = make(map[string]int, len(types))
+		for mt, n := range types {
+			resp.Types[mt.String()] = n
+		}
+	}
+
+	w.Header().Set(contentType, contentTypeJSON)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) removeConsumer(w http.ResponseWriter, r *http.Request) {
+	a := s.requestAccount(r)
+
+	consumer, err := consumerParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	err = a.sarc.RemoveConsumer(consumer)
+
+	switch {
+	case errors.Is(err, receiver.ErrConsumerNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		a.forgetLast(consumer)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 func requestLogger(logger zerolog.Logger) func(handler http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
@@ -7,8 +7,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
@@ -20,45 +25,20 @@ import (
 )
 
 type mockClient struct {
-	connectCalled int
-	connectErr    chan error
-	recvMsg       chan receiver.Message
-	recvErr       chan error
-
-	msgs []receiver.Message
+	msgs      []receiver.Message
+	consumers []string
+	timeouts  []time.Duration
 }
 
 func newMockClient() *mockClient {
 	return &mockClient{
-		connectErr: make(chan error),
-		recvMsg:    make(chan receiver.Message),
-		recvErr:    make(chan error),
-
 		msgs: []receiver.Message{},
 	}
 }
 
-func (mc *mockClient) Connect(_ context.Context) error {
-	mc.connectCalled++
-	if mc.connectErr != nil {
-		return <-mc.connectErr
-	}
-
-	return nil
-}
+func (mc *mockClient) Pop(consumer string, _ receiver.Filter) *receiver.Message {
+	mc.consumers = append(mc.consumers, consumer)
 
-func (mc *mockClient) ReceiveLoop(_ context.Context) error {
-	for {
-		select {
-		case msg := <-mc.recvMsg:
-			mc.msgs = append(mc.msgs, msg)
-		case err := <-mc.recvErr:
-			return err
-		}
-	}
-}
-
-func (mc *mockClient) Pop() *receiver.Message {
 	if len(mc.msgs) == 0 {
 		return nil
 	}
@@ -69,13 +49,251 @@ func (mc *mockClient) Pop() *receiver.Message {
 	return &msg
 }
 
-func (mc *mockClient) Flush() []receiver.Message {
+func (mc *mockClient) Flush(consumer string, _ receiver.Filter) []receiver.Message {
+	mc.consumers = append(mc.consumers, consumer)
+
 	msgs := mc.msgs
 	mc.msgs = []receiver.Message{}
 
 	return msgs
 }
 
+func (mc *mockClient) Lease(consumer string, timeout time.Duration) (*receiver.Message, string) {
+	mc.timeouts = append(mc.timeouts, timeout)
+
+	msg := mc.Pop(consumer, receiver.Filter{})
+	if msg == nil {
+		return nil, ""
+	}
+
+	return msg, "handle"
+}
+
+func (mc *mockClient) Since(_ uint64, _ int) []receiver.Message { return nil }
+
+func (mc *mockClient) Recorded() <-chan struct{} { return nil }
+
+func (mc *mockClient) Peek(_ string, _ int) []receiver.Message { return nil }
+
+func (mc *mockClient) Count(_ string) (int, map[receiver.MessageType]int) { return 0, nil }
+
+func (mc *mockClient) SubscribeFrames() (<-chan receiver.Frame, func()) { return nil, func() {} }
+
+func (mc *mockClient) SubscribeMessages() (<-chan receiver.Message, func()) { return nil, func() {} }
+
+func (mc *mockClient) LastID() uint64 { return 0 }
+
+func (mc *mockClient) Connected() bool { return true }
+
+func (mc *mockClient) LastFrame() time.Time { return time.Time{} }
+
+func (mc *mockClient) HasConsumer(_ string) bool { return true }
+
+func (mc *mockClient) RemoveConsumer(name string) error {
+	mc.consumers = append(mc.consumers, name)
+
+	return receiver.ErrConsumerNotFound
+}
+
+func (mc *mockClient) Ack(handle string) error {
+	if handle != "handle" {
+		return receiver.ErrLeaseNotFound
+	}
+
+	return nil
+}
+
+// storeClient is a client backed by a MemoryStore, it is used to test the
+// routes whose behavior is implemented by the store.
+type storeClient struct {
+	store *receiver.MemoryStore
+
+	mu       sync.Mutex
+	recorded chan struct{}
+	frames   []chan receiver.Frame
+	messages []chan receiver.Message
+
+	disconnected atomic.Bool
+	lastFrame    atomic.Int64
+}
+
+func newStoreClient(t *testing.T, msgs ...receiver.Message) *storeClient {
+	t.Helper()
+
+	sc := &storeClient{
+		store:    receiver.NewMemoryStore(receiver.StoreOptions{}),
+		recorded: make(chan struct{}),
+	}
+
+	require.NoError(t, sc.store.AddConsumer(receiver.DefaultConsumer))
+
+	for _, msg := range msgs {
+		sc.record(t, msg)
+	}
+
+	return sc
+}
+
+// record appends the message to the store and wakes up the long-polling
+// requests, like the receiver does when it records a message.
+func (sc *storeClient) record(t *testing.T, msg receiver.Message) {
+	t.Helper()
+
+	require.NoError(t, sc.store.Append(&msg))
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, ch := range sc.messages {
+		ch <- msg
+	}
+
+	close(sc.recorded)
+	sc.recorded = make(chan struct{})
+}
+
+// frame sends the frame to the subscribers, like the receiver does when it
+// receives a frame from the Signal API.
+func (sc *storeClient) frame(f receiver.Frame) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, ch := range sc.frames {
+		ch <- f
+	}
+}
+
+func (sc *storeClient) SubscribeFrames() (<-chan receiver.Frame, func()) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	ch := make(chan receiver.Frame, 1)
+	sc.frames = append(sc.frames, ch)
+
+	return ch, func() {}
+}
+
+func (sc *storeClient) SubscribeMessages() (<-chan receiver.Message, func()) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	ch := make(chan receiver.Message, 16)
+	sc.messages = append(sc.messages, ch)
+
+	return ch, func() {}
+}
+
+func (sc *storeClient) LastID() uint64 {
+	id, _ := sc.store.LastID()
+
+	return id
+}
+
+func (sc *storeClient) Recorded() <-chan struct{} {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	return sc.recorded
+}
+
+func (sc *storeClient) Connected() bool { return !sc.disconnected.Load() }
+
+func (sc *storeClient) LastFrame() time.Time {
+	if lastFrame := sc.lastFrame.Load(); lastFrame != 0 {
+		return time.Unix(0, lastFrame)
+	}
+
+	return time.Time{}
+}
+
+func (sc *storeClient) Pop(consumer string, filter receiver.Filter) *receiver.Message {
+	msg, _ := sc.store.Pop(consumer, filter.Match)
+
+	return msg
+}
+
+func (sc *storeClient) Flush(consumer string, filter receiver.Filter) []receiver.Message {
+	msgs, _ := sc.store.Flush(consumer, filter.Match)
+
+	return msgs
+}
+
+func (sc *storeClient) Lease(consumer string, timeout time.Duration) (*receiver.Message, string) {
+	msg, handle, _ := sc.store.Lease(consumer, timeout)
+
+	return msg, handle
+}
+
+func (sc *storeClient) Ack(handle string) error { return sc.store.Ack(handle) }
+
+func (sc *storeClient) HasConsumer(name string) bool {
+	names, _ := sc.store.Consumers()
+
+	return slices.Contains(names, name)
+}
+
+func (sc *storeClient) RemoveConsumer(name string) error { return sc.store.RemoveConsumer(name) }
+
+func (sc *storeClient) Peek(consumer string, limit int) []receiver.Message {
+	msgs, _ := sc.store.Peek(consumer, limit)
+
+	return msgs
+}
+
+func (sc *storeClient) Count(consumer string) (int, map[receiver.MessageType]int) {
+	msgs, _ := sc.store.Peek(consumer, 0)
+
+	types := make(map[receiver.MessageType]int)
+	for _, msg := range msgs {
+		for _, mt := range msg.MessageTypes() {
+			types[mt]++
+		}
+	}
+
+	return len(msgs), types
+}
+
+func (sc *storeClient) Since(cursor uint64, limit int) []receiver.Message {
+	msgs, _ := sc.store.Since(cursor, limit)
+
+	return msgs
+}
+
+type leaseResponse struct {
+	Handle  string            `json:"handle"`
+	Message *receiver.Message `json:"message"`
+}
+
+func lease(t *testing.T, url string) leaseResponse {
+	t.Helper()
+
+	//nolint:noctx
+	resp, err := http.Post(url, "", nil)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got leaseResponse
+
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+
+	return got
+}
+
+func postStatus(t *testing.T, url string) int {
+	t.Helper()
+
+	//nolint:noctx
+	resp, err := http.Post(url, "", nil)
+	require.NoError(t, err)
+
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
 func TestServeHTTP(t *testing.T) {
 	t.Parallel()
 
@@ -213,6 +431,75 @@ func TestServeHTTP(t *testing.T) {
 				assert.Equal(t, want, got)
 			}
 		})
+
+		t.Run("never repeats a view-once message", func(t *testing.T) {
+			t.Parallel()
+
+			mc := newMockClient()
+
+			s := server.New(newContext(), mc, true)
+
+			hs := httptest.NewServer(s)
+			defer hs.Close()
+
+			want := receiver.Message{
+				Account: "0",
+				Envelope: receiver.Envelope{
+					DataMessage: &receiver.DataMessage{ViewOnce: true},
+				},
+			}
+			mc.msgs = []receiver.Message{want}
+
+			for _, expected := range []receiver.Message{want, {}} {
+				//nolint:noctx
+				resp, err := http.Get(hs.URL + "/receive/pop")
+				require.NoError(t, err)
+
+				defer resp.Body.Close()
+
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+				var got receiver.Message
+
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+
+				assert.Equal(t, expected, got)
+			}
+		})
+
+		t.Run("does not repeat an older message after a view-once message", func(t *testing.T) {
+			t.Parallel()
+
+			mc := newMockClient()
+
+			s := server.New(newContext(), mc, true)
+
+			hs := httptest.NewServer(s)
+			defer hs.Close()
+
+			older := receiver.Message{Account: "0"}
+			viewOnce := receiver.Message{
+				Account: "1",
+				Envelope: receiver.Envelope{
+					DataMessage: &receiver.DataMessage{ViewOnce: true},
+				},
+			}
+			mc.msgs = []receiver.Message{older, viewOnce}
+
+			for _, expected := range []receiver.Message{older, viewOnce, {}} {
+				//nolint:noctx
+				resp, err := http.Get(hs.URL + "/receive/pop")
+				require.NoError(t, err)
+
+				defer resp.Body.Close()
+
+				var got receiver.Message
+
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+
+				assert.Equal(t, expected, got)
+			}
+		})
 	})
 
 	t.Run("GET /receive/flush", func(t *testing.T) {
@@ -315,6 +602,506 @@ func TestServeHTTP(t *testing.T) {
 		})
 	})
 
+	t.Run("consumers", func(t *testing.T) {
+		t.Parallel()
+
+		t.Run("unscoped routes use the default consumer", func(t *testing.T) {
+			t.Parallel()
+
+			mc := newMockClient()
+
+			s := server.New(newContext(), mc, false)
+
+			hs := httptest.NewServer(s)
+			defer hs.Close()
+
+			for _, route := range []string{"/receive/pop", "/receive/flush"} {
+				//nolint:noctx
+				resp, err := http.Get(hs.URL + route)
+				require.NoError(t, err)
+
+				resp.Body.Close()
+
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+
+			assert.Equal(t, []string{receiver.DefaultConsumer, receiver.DefaultConsumer}, mc.consumers)
+		})
+
+		t.Run("scoped routes use the named consumer", func(t *testing.T) {
+			t.Parallel()
+
+			mc := newMockClient()
+
+			s := server.New(newContext(), mc, false)
+
+			hs := httptest.NewServer(s)
+			defer hs.Close()
+
+			for _, route := range []string{"/receive/ha/pop", "/receive/node-red/flush"} {
+				//nolint:noctx
+				resp, err := http.Get(hs.URL + route)
+				require.NoError(t, err)
+
+				resp.Body.Close()
+
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+
+			assert.Equal(t, []string{"ha", "node-red"}, mc.consumers)
+		})
+
+		t.Run("invalid consumer names are rejected", func(t *testing.T) {
+			t.Parallel()
+
+			mc := newMockClient()
+
+			s := server.New(newContext(), mc, false)
+
+			hs := httptest.NewServer(s)
+			defer hs.Close()
+
+			//nolint:noctx
+			resp, err := http.Get(hs.URL + "/receive/-ha/pop")
+			require.NoError(t, err)
+
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Empty(t, mc.consumers)
+		})
+	})
+
+	t.Run("POST /receive/lease", func(t *testing.T) {
+		t.Parallel()
+
+		t.Run("a leased message is hidden until it is acked", func(t *testing.T) {
+			t.Parallel()
+
+			sc := newStoreClient(t, receiver.Message{Account: "0"}, receiver.Message{Account: "1"})
+
+			hs := httptest.NewServer(server.New(newContext(), sc, false))
+			defer hs.Close()
+
+			got := lease(t, hs.URL+"/receive/lease")
+			require.NotEmpty(t, got.Handle)
+			assert.Equal(t, &receiver.Message{ID: 1, Account: "0"}, got.Message)
+
+			//nolint:noctx
+			resp, err := http.Get(hs.URL + "/receive/flush")
+			require.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			var msgs []receiver.Message
+
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&msgs))
+			assert.Equal(t, []receiver.Message{{ID: 2, Account: "1"}}, msgs)
+
+			assert.Equal(t, http.StatusNoContent, postStatus(t, hs.URL+"/receive/ack/"+got.Handle))
+			assert.Equal(t, http.StatusNotFound, postStatus(t, hs.URL+"/receive/ack/"+got.Handle))
+
+			assert.Equal(t, leaseResponse{}, lease(t, hs.URL+"/receive/lease"))
+		})
+
+		t.Run("a message is delivered again once its lease expires", func(t *testing.T) {
+			t.Parallel()
+
+			sc := newStoreClient(t, receiver.Message{Account: "0"})
+
+			hs := httptest.NewServer(server.New(newContext(), sc, false))
+			defer hs.Close()
+
+			first := lease(t, hs.URL+"/receive/lease?timeout=1ms")
+			require.NotEmpty(t, first.Handle)
+
+			time.Sleep(10 * time.Millisecond)
+
+			assert.Equal(t, http.StatusNotFound, postStatus(t, hs.URL+"/receive/ack/"+first.Handle))
+
+			second := lease(t, hs.URL+"/receive/lease")
+			assert.Equal(t, first.Message, second.Message)
+			assert.NotEqual(t, first.Handle, second.Handle)
+		})
+
+		t.Run("an unknown handle is not found", func(t *testing.T) {
+			t.Parallel()
+
+			hs := httptest.NewServer(server.New(newContext(), newStoreClient(t), false))
+			defer hs.Close()
+
+			assert.Equal(t, http.StatusNotFound, postStatus(t, hs.URL+"/receive/ack/unknown"))
+		})
+
+		t.Run("the default timeout is used and the consumer is scoped", func(t *testing.T) {
+			t.Parallel()
+
+			mc := newMockClient()
+
+			hs := httptest.NewServer(server.New(newContext(), mc, false))
+			defer hs.Close()
+
+			lease(t, hs.URL+"/receive/lease")
+			lease(t, hs.URL+"/receive/ha/lease?timeout=5m")
+
+			assert.Equal(t, []string{receiver.DefaultConsumer, "ha"}, mc.consumers)
+			assert.Equal(t, []time.Duration{30 * time.Second, 5 * time.Minute}, mc.timeouts)
+		})
+
+		for _, timeout := range []string{"abc", "0s", "-1s", "13h"} {
+			t.Run("an invalid timeout "+timeout+" is rejected", func(t *testing.T) {
+				t.Parallel()
+
+				mc := newMockClient()
+
+				hs := httptest.NewServer(server.New(newContext(), mc, false))
+				defer hs.Close()
+
+				assert.Equal(t, http.StatusBadRequest, postStatus(t, hs.URL+"/receive/lease?timeout="+timeout))
+				assert.Empty(t, mc.timeouts)
+			})
+		}
+	})
+
+	t.Run("GET /receive/since", func(t *testing.T) {
+		t.Parallel()
+
+		type sinceResponse struct {
+			Messages []receiver.Message `json:"messages"`
+			Cursor   uint64             `json:"cursor"`
+		}
+
+		since := func(t *testing.T, url string) (int, sinceResponse) {
+			t.Helper()
+
+			//nolint:noctx
+			resp, err := http.Get(url)
+			require.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			var got sinceResponse
+
+			if resp.StatusCode == http.StatusOK {
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+			}
+
+			return resp.StatusCode, got
+		}
+
+		sc := newStoreClient(t, receiver.Message{Account: "0"}, receiver.Message{Account: "1"}, receiver.Message{Account: "2"})
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false))
+		defer hs.Close()
+
+		status, got := since(t, hs.URL+"/receive/since?limit=2")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, sinceResponse{
+			Messages: []receiver.Message{{ID: 1, Account: "0"}, {ID: 2, Account: "1"}},
+			Cursor:   2,
+		}, got)
+
+		status, got = since(t, hs.URL+"/receive/since?cursor=2")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, sinceResponse{Messages: []receiver.Message{{ID: 3, Account: "2"}}, Cursor: 3}, got)
+
+		status, got = since(t, hs.URL+"/receive/since?cursor=3")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, sinceResponse{Messages: []receiver.Message{}, Cursor: 3}, got)
+
+		for _, query := range []string{"cursor=-1", "cursor=abc", "limit=0", "limit=abc"} {
+			status, _ = since(t, hs.URL+"/receive/since?"+query)
+			assert.Equal(t, http.StatusBadRequest, status, query)
+		}
+
+		// since does not consume the messages.
+		assert.Len(t, sc.Flush(receiver.DefaultConsumer, receiver.Filter{}), 3)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		t.Parallel()
+
+		text := func(s string) *string { return &s }
+
+		flush := func(t *testing.T, url string) (int, []receiver.Message) {
+			t.Helper()
+
+			//nolint:noctx
+			resp, err := http.Get(url)
+			require.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			var got []receiver.Message
+
+			if resp.StatusCode == http.StatusOK {
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+			}
+
+			return resp.StatusCode, got
+		}
+
+		sc := newStoreClient(t,
+			receiver.Message{Envelope: receiver.Envelope{
+				Source: "+1", DataMessage: &receiver.DataMessage{Message: text("lights on")},
+			}},
+			receiver.Message{Envelope: receiver.Envelope{
+				Source: "+2", DataMessage: &receiver.DataMessage{Message: text("hello")},
+			}},
+			receiver.Message{Envelope: receiver.Envelope{
+				Source: "+1", DataMessage: &receiver.DataMessage{Message: text("lights off")},
+			}},
+			receiver.Message{Envelope: receiver.Envelope{Source: "+1", ReceiptMessage: &receiver.ReceiptMessage{}}},
+		)
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false))
+		defer hs.Close()
+
+		ids := func(msgs []receiver.Message) []uint64 {
+			ids := make([]uint64, 0, len(msgs))
+			for _, msg := range msgs {
+				ids = append(ids, msg.ID)
+			}
+
+			return ids
+		}
+
+		query := url.Values{"source": {"+1"}, "type": {"data-message"}, "text~": {"^lights"}}
+
+		status, got := flush(t, hs.URL+"/receive/flush?"+query.Encode())
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []uint64{1, 3}, ids(got))
+
+		// the messages that did not match stay queued in order.
+		status, got = flush(t, hs.URL+"/receive/flush")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []uint64{2, 4}, ids(got))
+
+		for _, query := range []string{"type=unknown", "text~=(", "hasAttachment=maybe"} {
+			status, _ = flush(t, hs.URL+"/receive/flush?"+query)
+			assert.Equal(t, http.StatusBadRequest, status, query)
+
+			//nolint:noctx
+			resp, err := http.Get(hs.URL + "/receive/pop?" + query)
+			require.NoError(t, err)
+
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+	})
+
+	t.Run("long-polling with ?wait=", func(t *testing.T) {
+		t.Parallel()
+
+		get := func(t *testing.T, url string) (int, string) {
+			t.Helper()
+
+			//nolint:noctx
+			resp, err := http.Get(url)
+			require.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			return resp.StatusCode, string(body)
+		}
+
+		for _, route := range []string{"/receive/pop", "/receive/flush"} {
+			t.Run(route+" returns as soon as a message is recorded", func(t *testing.T) {
+				t.Parallel()
+
+				sc := newStoreClient(t)
+
+				hs := httptest.NewServer(server.New(newContext(), sc, false))
+				defer hs.Close()
+
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					sc.record(t, receiver.Message{Account: "0"})
+				}()
+
+				start := time.Now()
+				status, body := get(t, hs.URL+route+"?wait=1m")
+
+				assert.Equal(t, http.StatusOK, status)
+				assert.Contains(t, body, `"account":"0"`)
+				assert.Less(t, time.Since(start), time.Minute)
+			})
+		}
+
+		t.Run("nothing is returned once the wait expires", func(t *testing.T) {
+			t.Parallel()
+
+			hs := httptest.NewServer(server.New(newContext(), newStoreClient(t), false))
+			defer hs.Close()
+
+			start := time.Now()
+			status, body := get(t, hs.URL+"/receive/pop?wait=50ms")
+
+			assert.Equal(t, http.StatusOK, status)
+			assert.NotContains(t, body, `"id"`)
+			assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+			status, body = get(t, hs.URL+"/receive/flush?wait=50ms")
+
+			assert.Equal(t, http.StatusOK, status)
+			assert.JSONEq(t, "[]", body)
+		})
+
+		t.Run("a queued message is returned without waiting", func(t *testing.T) {
+			t.Parallel()
+
+			hs := httptest.NewServer(server.New(newContext(), newStoreClient(t, receiver.Message{Account: "0"}), false))
+			defer hs.Close()
+
+			start := time.Now()
+			status, body := get(t, hs.URL+"/receive/pop?wait=1m")
+
+			assert.Equal(t, http.StatusOK, status)
+			assert.Contains(t, body, `"account":"0"`)
+			assert.Less(t, time.Since(start), time.Minute)
+		})
+
+		t.Run("the wait ends when the client goes away", func(t *testing.T) {
+			t.Parallel()
+
+			sc := newStoreClient(t)
+
+			hs := httptest.NewServer(server.New(newContext(), sc, false))
+			defer hs.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			r, err := http.NewRequestWithContext(ctx, http.MethodGet, hs.URL+"/receive/pop?wait=1m", nil)
+			require.NoError(t, err)
+
+			_, err = http.DefaultClient.Do(r) //nolint:bodyclose
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+
+			// give the server the time to notice, a message recorded after the
+			// client went away must not be consumed by the abandoned request.
+			time.Sleep(100 * time.Millisecond)
+			sc.record(t, receiver.Message{Account: "0"})
+			time.Sleep(50 * time.Millisecond)
+
+			assert.NotNil(t, sc.Pop(receiver.DefaultConsumer, receiver.Filter{}))
+		})
+
+		for _, wait := range []string{"abc", "0s", "-1s", "6m"} {
+			t.Run("an invalid wait "+wait+" is rejected", func(t *testing.T) {
+				t.Parallel()
+
+				hs := httptest.NewServer(server.New(newContext(), newStoreClient(t), false))
+				defer hs.Close()
+
+				status, _ := get(t, hs.URL+"/receive/pop?wait="+wait)
+				assert.Equal(t, http.StatusBadRequest, status)
+			})
+		}
+	})
+
+	t.Run("GET /receive/peek and /receive/count", func(t *testing.T) {
+		t.Parallel()
+
+		get := func(t *testing.T, url string, v any) int {
+			t.Helper()
+
+			//nolint:noctx
+			resp, err := http.Get(url)
+			require.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			if resp.StatusCode == http.StatusOK {
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+			}
+
+			return resp.StatusCode
+		}
+
+		text := "hello"
+
+		sc := newStoreClient(t,
+			receiver.Message{Account: "0", Envelope: receiver.Envelope{DataMessage: &receiver.DataMessage{Message: &text}}},
+			receiver.Message{Account: "1", Envelope: receiver.Envelope{ReceiptMessage: &receiver.ReceiptMessage{}}},
+			receiver.Message{Account: "2", Envelope: receiver.Envelope{DataMessage: &receiver.DataMessage{Message: &text}}},
+		)
+		require.NoError(t, sc.store.AddConsumer("ha"))
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false))
+		defer hs.Close()
+
+		var msgs []receiver.Message
+
+		assert.Equal(t, http.StatusOK, get(t, hs.URL+"/receive/peek?limit=2", &msgs))
+		require.Len(t, msgs, 2)
+		assert.Equal(t, "0", msgs[0].Account)
+		assert.Equal(t, "1", msgs[1].Account)
+
+		assert.Equal(t, http.StatusOK, get(t, hs.URL+"/receive/ha/peek", &msgs))
+		assert.Len(t, msgs, 3)
+
+		type countResponse struct {
+			Count int            `json:"count"`
+			Types map[string]int `json:"types"`
+		}
+
+		var count countResponse
+
+		assert.Equal(t, http.StatusOK, get(t, hs.URL+"/receive/count", &count))
+		assert.Equal(t, countResponse{Count: 3}, count)
+
+		count = countResponse{}
+
+		assert.Equal(t, http.StatusOK, get(t, hs.URL+"/receive/ha/count?byType=true", &count))
+		assert.Equal(t, countResponse{
+			Count: 3,
+			Types: map[string]int{"data": 2, "data-message": 2, "receipt": 1},
+		}, count)
+
+		assert.Equal(t, http.StatusBadRequest, get(t, hs.URL+"/receive/peek?limit=0", &msgs))
+		assert.Equal(t, http.StatusBadRequest, get(t, hs.URL+"/receive/count?byType=maybe", &count))
+		assert.Equal(t, http.StatusBadRequest, get(t, hs.URL+"/receive/-typo/count", &count))
+		assert.Equal(t, http.StatusNotFound, get(t, hs.URL+"/receive/typo/count", &count))
+		assert.Equal(t, http.StatusNotFound, get(t, hs.URL+"/receive/typo/peek", &msgs))
+		assert.Equal(t, http.StatusNotFound, get(t, hs.URL+"/receive/typo/pop", &msgs))
+
+		// neither peek nor count consume the messages.
+		assert.Len(t, sc.Flush(receiver.DefaultConsumer, receiver.Filter{}), 3)
+	})
+
+	t.Run("DELETE /consumers/{consumer}", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t)
+		require.NoError(t, sc.store.AddConsumer("ha"))
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false))
+		defer hs.Close()
+
+		for route, want := range map[string]int{
+			"/consumers/ha":    http.StatusNoContent,
+			"/consumers/typo":  http.StatusNotFound,
+			"/consumers/-typo": http.StatusBadRequest,
+		} {
+			r, err := http.NewRequestWithContext(context.Background(), http.MethodDelete, hs.URL+route, nil)
+			require.NoError(t, err)
+
+			resp, err := http.DefaultClient.Do(r)
+			require.NoError(t, err)
+
+			resp.Body.Close()
+
+			assert.Equal(t, want, resp.StatusCode, route)
+		}
+
+		require.ErrorIs(t, sc.store.RemoveConsumer("ha"), receiver.ErrConsumerNotFound)
+	})
+
 	t.Run("anything else", func(t *testing.T) {
 		t.Parallel()
 
@@ -379,30 +1166,63 @@ func TestServeHTTP(t *testing.T) {
 	})
 }
 
-func TestServerReconnect(t *testing.T) {
+func TestDrain(t *testing.T) {
 	t.Parallel()
 
-	mc := newMockClient()
+	sc := newStoreClient(t)
+	srv := server.New(newContext(), sc, false, server.WithAccount("+1", sc))
 
-	server.New(newContext(), mc, false)
+	hs := httptest.NewUnstartedServer(srv)
+	hs.Config.RegisterOnShutdown(srv.Drain)
+	hs.Start()
+	t.Cleanup(hs.Close)
 
-	assert.Zero(t, mc.connectCalled)
+	popped := make(chan string, 1)
 
-	mc.recvMsg <- receiver.Message{Account: "0"}
+	go func() {
+		//nolint:noctx
+		resp, err := http.Get(hs.URL + "/receive/flush?wait=1m")
+		if !assert.NoError(t, err) {
+			popped <- ""
 
-	mc.recvErr <- nil
+			return
+		}
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		popped <- string(body)
+	}()
+
+	next := subscribe(t, hs.URL, "")
+
+	//nolint:bodyclose
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http")+"/v1/receive/+1", nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { conn.Close() })
 
-	mc.connectErr <- nil
+	// let the long-poll start waiting.
+	time.Sleep(100 * time.Millisecond)
 
-	assert.Len(t, mc.msgs, 1)
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
 
-	mc.recvMsg <- receiver.Message{Account: "0"}
+	start := time.Now()
 
-	assert.Equal(t, 1, mc.connectCalled)
+	require.NoError(t, hs.Config.Shutdown(ctx))
+	assert.Less(t, time.Since(start), 5*time.Second)
 
-	mc.recvErr <- nil
+	// the long-poll returns what was recorded so far, the streams end.
+	assert.JSONEq(t, `[]`, <-popped)
+	assert.Empty(t, next())
 
-	assert.Len(t, mc.msgs, 2)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
 }
 
 func TestRepeatLastMessage(t *testing.T) {
@@ -426,6 +1246,10 @@ func TestRepeatLastMessage(t *testing.T) {
 
 			var sentC chan struct{}
 
+			// done lets the handler waiting for the next messages return, so the
+			// test server can close.
+			done := make(chan struct{})
+
 			ch := make(chan chan receiver.Message, 1)
 			trs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				upgrader := websocket.Upgrader{}
@@ -438,7 +1262,14 @@ func TestRepeatLastMessage(t *testing.T) {
 				}
 				defer conn.Close()
 
-				messages := <-ch
+				var messages chan receiver.Message
+
+				select {
+				case messages = <-ch:
+				case <-done:
+					return
+				}
+
 				for msg := range messages {
 					if err := conn.WriteJSON(msg); err != nil {
 						t.Errorf("write message: %v", err)
@@ -451,15 +1282,25 @@ func TestRepeatLastMessage(t *testing.T) {
 			}))
 
 			defer trs.Close()
+			defer close(done)
 
 			uri, err := url.Parse(trs.URL)
 			require.NoError(t, err)
 
 			uri.Scheme = "ws"
 
-			client, err := receiver.New(newContext(), uri, receiver.MessageTypeDataMessage.String())
+			client, err := receiver.New(newContext(), uri, receiver.Options{
+				MessageTypes: []string{receiver.MessageTypeDataMessage.String()},
+				// the test server closes the websocket after every batch.
+				Reconnect: receiver.ReconnectPolicy{InitialDelay: 10 * time.Millisecond},
+			})
 			require.NoError(t, err)
 
+			ctx, cancel := context.WithCancel(newContext())
+			defer cancel()
+
+			go client.Run(ctx) //nolint:errcheck
+
 			s := server.New(newContext(), client, withRepeatFeature)
 
 			tss := httptest.NewServer(s)
@@ -479,9 +1320,15 @@ func TestRepeatLastMessage(t *testing.T) {
 
 				ch <- messages
 
-				// wait for the receiver to read all messages
+				// wait for the receiver to record all messages
 				<-sentC
 
+				require.Eventually(t, func() bool {
+					n, _ := client.Count(receiver.DefaultConsumer)
+
+					return n == 3
+				}, 5*time.Second, 10*time.Millisecond)
+
 				for j := 1; j <= 3; j++ {
 					r, err := http.NewRequestWithContext(newContext(), http.MethodGet, tss.URL+"/receive/pop", nil)
 					require.NoError(t, err)
@@ -502,6 +1349,9 @@ func TestRepeatLastMessage(t *testing.T) {
 					require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg))
 
 					lastMessage = strconv.Itoa(i * j)
+
+					require.NotNil(t, msg.Envelope.DataMessage)
+					require.NotNil(t, msg.Envelope.DataMessage.Message)
 					assert.Equal(t, lastMessage, *msg.Envelope.DataMessage.Message)
 				}
 			}
@@ -513,12 +1363,6 @@ func TestRepeatLastMessage(t *testing.T) {
 				resp, err := http.DefaultClient.Do(r)
 				require.NoError(t, err)
 
-				if !withRepeatFeature {
-					require.Equal(t, http.StatusNoContent, resp.StatusCode)
-
-					return
-				}
-
 				require.Equal(t, http.StatusOK, resp.StatusCode)
 
 				defer func() {
@@ -531,6 +1375,15 @@ func TestRepeatLastMessage(t *testing.T) {
 
 				require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg))
 
+				if !withRepeatFeature {
+					// an empty queue pops an empty message.
+					assert.Equal(t, receiver.Message{}, msg)
+
+					continue
+				}
+
+				require.NotNil(t, msg.Envelope.DataMessage)
+				require.NotNil(t, msg.Envelope.DataMessage.Message)
 				assert.Equal(t, lastMessage, *msg.Envelope.DataMessage.Message)
 			}
 		}
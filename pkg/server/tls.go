@@ -0,0 +1,172 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrNoClientCA is returned if the client CA file holds no certificate.
+var ErrNoClientCA = errors.New("no certificate found in the client CA file")
+
+// tlsReloadInterval is how often the TLS files are checked for changes if
+// TLSOptions.ReloadInterval is not set.
+const tlsReloadInterval = 10 * time.Second
+
+// TLSOptions configures the TLS config returned by NewTLSConfig.
+type TLSOptions struct {
+	// CertFile and KeyFile are the PEM encoded certificate and key served.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is the PEM encoded CA that must have signed the client
+	// certificates. Client certificates are not requested if it is empty.
+	ClientCAFile string
+
+	// ReloadInterval is how often the files are checked for changes, it
+	// defaults to 10 seconds if it is not positive. The files are checked on a
+	// handshake rather than on every one of them.
+	ReloadInterval time.Duration
+}
+
+// tlsReloader holds the certificates loaded from the files, and loads them
+// again when the files change on disk.
+type tlsReloader struct {
+	logger zerolog.Logger
+	opts   TLSOptions
+
+	// base is the config returned by NewTLSConfig, the config of a handshake is
+	// a clone of it so the settings of the server, such as the protocols it
+	// negotiates, are kept.
+	base *tls.Config
+
+	mu        sync.Mutex
+	checked   time.Time
+	loaded    []time.Time
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewTLSConfig returns a TLS config serving the certificate, and requiring
+// client certificates signed by the client CA if one is set. The files are
+// loaded again on a handshake after they change on disk, so rotated
+// certificates are picked up without a restart.
+func NewTLSConfig(logger zerolog.Logger, opts TLSOptions) (*tls.Config, error) {
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = tlsReloadInterval
+	}
+
+	r := &tlsReloader{logger: logger, opts: opts}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	r.checked = time.Now()
+
+	r.base = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		NextProtos:         []string{"h2", "http/1.1"},
+		GetConfigForClient: r.configForClient,
+	}
+
+	return r.base, nil
+}
+
+// modTimes returns the modification times of the files.
+func (r *tlsReloader) modTimes() ([]time.Time, error) {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+
+	modTimes := make([]time.Time, 0, len(files))
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the TLS files: %w", err)
+		}
+
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	return modTimes, nil
+}
+
+// load loads the files unless they did not change since they were loaded. The
+// loaded files are kept if the new ones cannot be loaded. r.mu must be held
+// once the reloader is shared.
+func (r *tlsReloader) load() error {
+	modTimes, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	if r.cert != nil && slices.EqualFunc(modTimes, r.loaded, time.Time.Equal) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("error loading the TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("error reading the client CA: %w", err)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%w: %s", ErrNoClientCA, r.opts.ClientCAFile)
+		}
+	}
+
+	if r.cert != nil {
+		r.logger.Info().Str("cert", r.opts.CertFile).Msg("the TLS certificates were reloaded")
+	}
+
+	r.loaded = modTimes
+	r.cert = &cert
+	r.clientCAs = clientCAs
+
+	return nil
+}
+
+// configForClient returns the config of a handshake, the base config with the
+// certificates loaded last. The files are checked for changes at most once per
+// reload interval.
+func (r *tlsReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now := time.Now(); now.Sub(r.checked) >= r.opts.ReloadInterval {
+		r.checked = now
+
+		if err := r.load(); err != nil {
+			r.logger.Error().Err(err).Msg("error reloading the TLS certificates, serving the previous ones")
+		}
+	}
+
+	cfg := r.base.Clone()
+	cfg.GetConfigForClient = nil
+	cfg.Certificates = []tls.Certificate{*r.cert}
+
+	if r.clientCAs != nil {
+		cfg.ClientCAs = r.clientCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,255 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/server"
+)
+
+// testCA signs the certificates of the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pool: pool,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM encoded certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes the file with a modification time after the previous one, so
+// a rewrite is noticed even on filesystems with a coarse time resolution.
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func serveTLS(t *testing.T, opts server.TLSOptions) *httptest.Server {
+	t.Helper()
+
+	cfg, err := server.NewTLSConfig(zerolog.Nop(), opts)
+	require.NoError(t, err)
+
+	hs := httptest.NewUnstartedServer(server.New(newContext(), newStoreClient(t), false))
+	hs.EnableHTTP2 = true
+	hs.TLS = cfg
+	hs.StartTLS()
+	t.Cleanup(hs.Close)
+
+	return hs
+}
+
+func tlsClient(ca *testCA, certs ...tls.Certificate) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		ForceAttemptHTTP2: true,
+		TLSClientConfig: &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			RootCAs:      ca.pool,
+			Certificates: certs,
+		},
+	}}
+}
+
+func TestTLS(t *testing.T) {
+	t.Parallel()
+
+	t.Run("serves the certificate and reloads it when it changes", func(t *testing.T) {
+		t.Parallel()
+
+		ca := newTestCA(t)
+		dir := t.TempDir()
+		opts := server.TLSOptions{
+			CertFile:       filepath.Join(dir, "tls.crt"),
+			KeyFile:        filepath.Join(dir, "tls.key"),
+			ReloadInterval: 250 * time.Millisecond,
+		}
+
+		certPEM, keyPEM := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+		writeFile(t, opts.CertFile, certPEM, time.Now().Add(-time.Minute))
+		writeFile(t, opts.KeyFile, keyPEM, time.Now().Add(-time.Minute))
+
+		hs := serveTLS(t, opts)
+
+		served := func() string {
+			t.Helper()
+
+			// a new client for every request, so every request is a new handshake.
+			//nolint:noctx
+			resp, err := tlsClient(ca).Get(hs.URL + "/healthz")
+			require.NoError(t, err)
+
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, 2, resp.ProtoMajor, "HTTP/2 is negotiated")
+
+			return resp.TLS.PeerCertificates[0].Subject.CommonName
+		}
+
+		assert.Equal(t, "first", served())
+
+		certPEM, keyPEM = ca.issue(t, "rotated", x509.ExtKeyUsageServerAuth)
+		writeFile(t, opts.CertFile, certPEM, time.Now())
+		writeFile(t, opts.KeyFile, keyPEM, time.Now())
+
+		// the files are not checked again within the reload interval.
+		assert.Equal(t, "first", served())
+
+		assert.Eventually(t, func() bool { return served() == "rotated" }, 5*time.Second, 10*time.Millisecond)
+
+		// a broken certificate is not served, the previous one is kept.
+		writeFile(t, opts.CertFile, []byte("garbage"), time.Now().Add(time.Minute))
+		time.Sleep(2 * opts.ReloadInterval)
+
+		assert.Equal(t, "rotated", served())
+	})
+
+	t.Run("requires a client certificate signed by the client CA", func(t *testing.T) {
+		t.Parallel()
+
+		ca := newTestCA(t)
+		dir := t.TempDir()
+		opts := server.TLSOptions{
+			CertFile:     filepath.Join(dir, "tls.crt"),
+			KeyFile:      filepath.Join(dir, "tls.key"),
+			ClientCAFile: filepath.Join(dir, "ca.crt"),
+		}
+
+		certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+		writeFile(t, opts.CertFile, certPEM, time.Now())
+		writeFile(t, opts.KeyFile, keyPEM, time.Now())
+		writeFile(t, opts.ClientCAFile, ca.pem, time.Now())
+
+		hs := serveTLS(t, opts)
+
+		//nolint:noctx
+		_, err := tlsClient(ca).Get(hs.URL + "/healthz")
+		require.Error(t, err)
+
+		other := newTestCA(t)
+		certPEM, keyPEM = other.issue(t, "stranger", x509.ExtKeyUsageClientAuth)
+		stranger, err := tls.X509KeyPair(certPEM, keyPEM)
+		require.NoError(t, err)
+
+		//nolint:noctx
+		_, err = tlsClient(ca, stranger).Get(hs.URL + "/healthz")
+		require.Error(t, err)
+
+		certPEM, keyPEM = ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+		client, err := tls.X509KeyPair(certPEM, keyPEM)
+		require.NoError(t, err)
+
+		//nolint:noctx
+		resp, err := tlsClient(ca, client).Get(hs.URL + "/healthz")
+		require.NoError(t, err)
+
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("missing or invalid files are an error", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		_, err := server.NewTLSConfig(zerolog.Nop(), server.TLSOptions{
+			CertFile: filepath.Join(dir, "tls.crt"),
+			KeyFile:  filepath.Join(dir, "tls.key"),
+		})
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		ca := newTestCA(t)
+		certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+		writeFile(t, filepath.Join(dir, "tls.crt"), certPEM, time.Now())
+		writeFile(t, filepath.Join(dir, "tls.key"), keyPEM, time.Now())
+		writeFile(t, filepath.Join(dir, "ca.crt"), []byte("garbage"), time.Now())
+
+		_, err = server.NewTLSConfig(zerolog.Nop(), server.TLSOptions{
+			CertFile:     filepath.Join(dir, "tls.crt"),
+			KeyFile:      filepath.Join(dir, "tls.key"),
+			ClientCAFile: filepath.Join(dir, "ca.crt"),
+		})
+		require.ErrorIs(t, err, server.ErrNoClientCA)
+	})
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	routeReceiveWebsocket = "/v1/receive/{account}"
+
+	// websocketWriteTimeout bounds the time a frame takes to be written to a
+	// websocket client.
+	websocketWriteTimeout = 10 * time.Second
+)
+
+// receiveWebsocket re-broadcasts the frames received from the Signal API for
+// the account, unmodified, to the websocket client. Every client gets a copy
+// of every frame, so several tools written against the Signal API can share it.
+// An account that is not served is rejected before the upgrade.
+func (s *Server) receiveWebsocket(w http.ResponseWriter, r *http.Request) {
+	account := chi.URLParam(r, "account")
+
+	a := s.accounts[account]
+	if a == nil {
+		http.Error(w, errAccountNotFound.Error(), http.StatusNotFound)
+
+		return
+	}
+
+	// subscribe before the upgrade so no frame is missed once it completes.
+	frames, stop := a.sarc.SubscribeFrames()
+	defer stop()
+
+	var upgrader websocket.Upgrader
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied with the error.
+		return
+	}
+
+	defer conn.Close()
+
+	// read and discard what the client sends, this handles the control frames
+	// and notices when the client goes away.
+	gone := make(chan struct{})
+
+	go func() {
+		defer close(gone)
+
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case f, ok := <-frames:
+			if !ok {
+				s.logger.Warn().Str("account", account).Msg("closing a websocket client that fell behind")
+
+				//nolint:errcheck
+				conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind"),
+					time.Now().Add(websocketWriteTimeout),
+				)
+
+				return
+			}
+
+			if f.Account != account {
+				continue
+			}
+
+			if err := conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout)); err != nil {
+				return
+			}
+
+			if err := conn.WriteMessage(websocket.TextMessage, f.Data); err != nil {
+				return
+			}
+		case <-s.draining:
+			//nolint:errcheck
+			conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"),
+				time.Now().Add(websocketWriteTimeout),
+			)
+
+			return
+		case <-gone:
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kalbasit/signal-api-receiver/pkg/receiver"
+	"github.com/kalbasit/signal-api-receiver/pkg/server"
+)
+
+func TestReceiveWebsocket(t *testing.T) {
+	t.Parallel()
+
+	t.Run("every client gets a copy of the frames of its account", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t)
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false, server.WithAccount("+1", sc)))
+		t.Cleanup(hs.Close)
+
+		wsURL := "ws" + strings.TrimPrefix(hs.URL, "http") + "/v1/receive/+1"
+
+		var conns []*websocket.Conn
+
+		for range 2 {
+			//nolint:bodyclose
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+			require.NoError(t, err)
+
+			t.Cleanup(func() { conn.Close() })
+
+			conns = append(conns, conn)
+		}
+
+		sc.frame(receiver.Frame{Account: "+1", Data: []byte(`{"account":"+1","n":1}`)})
+		sc.frame(receiver.Frame{Account: "+2", Data: []byte(`{"account":"+2"}`)})
+		sc.frame(receiver.Frame{Account: "+1", Data: []byte(`{"account":"+1","n":2}`)})
+
+		for _, conn := range conns {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+			for _, want := range []string{`{"account":"+1","n":1}`, `{"account":"+1","n":2}`} {
+				mt, data, err := conn.ReadMessage()
+				require.NoError(t, err)
+
+				assert.Equal(t, websocket.TextMessage, mt)
+				assert.Equal(t, want, string(data))
+			}
+		}
+	})
+
+	t.Run("a request that is not a websocket upgrade is rejected", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t)
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false, server.WithAccount("+1", sc)))
+		t.Cleanup(hs.Close)
+
+		r, err := http.NewRequestWithContext(context.Background(), http.MethodGet, hs.URL+"/v1/receive/+1", nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("an account that is not served is not found", func(t *testing.T) {
+		t.Parallel()
+
+		sc := newStoreClient(t)
+
+		hs := httptest.NewServer(server.New(newContext(), sc, false, server.WithAccount("+1", sc)))
+		t.Cleanup(hs.Close)
+
+		//nolint:bodyclose
+		_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http")+"/v1/receive/+2", nil)
+		require.ErrorIs(t, err, websocket.ErrBadHandshake)
+		require.NotNil(t, resp)
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}